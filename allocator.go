@@ -0,0 +1,65 @@
+package mcts
+
+// defaultAllocationInterval is used when an Allocator is set without an
+// AllocationInterval
+const defaultAllocationInterval = 100
+
+// BudgetAllocator decides how many of the remaining iterations each subtree
+// of the search receives. Allocate is called every AllocationInterval
+// iterations with the current tree and the number of iterations left, 0 when
+// the search is only bounded by MaxDuration, and returns the budget of each
+// subtree root. Iterations start their selection from an allocated subtree
+// root until its budget is spent; once every budget is spent they start from
+// the root again.
+type BudgetAllocator interface {
+	Allocate(tree *Tree, totalBudget int) map[*Node]int
+}
+
+// allocatedSubtree is a subtree root with the iterations it has left
+type allocatedSubtree struct {
+	node   *Node
+	budget int
+}
+
+// allocate asks config.Allocator for a new allocation, keeping the subtrees
+// in preorder so the order they are served in does not depend on map
+// iteration. Nodes outside the tree are ignored. Must be called with st.mu
+// held.
+func (st *searchState) allocate(i int) {
+	remaining := 0
+	if st.config.MaxIterations > 0 {
+		remaining = st.config.MaxIterations - i
+	}
+	budgets := st.config.Allocator.Allocate(&Tree{Root: st.root}, remaining)
+
+	st.allocation = st.allocation[:0]
+	stack := []*Node{st.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if budget := budgets[node]; budget > 0 {
+			st.allocation = append(st.allocation, allocatedSubtree{node: node, budget: budget})
+		}
+		children := node.childrenSnapshot()
+		for c := len(children) - 1; c >= 0; c-- {
+			stack = append(stack, children[c])
+		}
+	}
+}
+
+// nextStart returns the node the next iteration starts its selection from,
+// the allocated subtree with the most budget left, or the root when nothing
+// is allocated. Must be called with st.mu held.
+func (st *searchState) nextStart() *Node {
+	best := -1
+	for j, subtree := range st.allocation {
+		if subtree.budget > 0 && (best < 0 || subtree.budget > st.allocation[best].budget) {
+			best = j
+		}
+	}
+	if best < 0 {
+		return st.root
+	}
+	st.allocation[best].budget--
+	return st.allocation[best].node
+}
@@ -0,0 +1,62 @@
+package mcts
+
+import "sync"
+
+// Sizes of the blocks a nodeArena allocates at once
+const (
+	arenaNodes = 128
+	arenaMoves = 2048
+)
+
+// nodeArena hands out the nodes added to a search tree, and their
+// sequences, from blocks allocated together, so growing the tree costs a
+// few large allocations instead of two per node. Blocks are not recycled:
+// the collector frees a block once none of its nodes or sequences is
+// referenced anymore, so a pruned node keeps its whole block alive.
+// Searches bounding their memory with MaxNodes or PruneThreshold therefore
+// allocate nodes one at a time.
+type nodeArena struct {
+	mu    sync.Mutex
+	nodes []Node
+	moves []interface{}
+}
+
+// node returns a zeroed node, or a new one from the heap when arena is nil
+func (arena *nodeArena) node() *Node {
+	if arena == nil {
+		return &Node{}
+	}
+
+	arena.mu.Lock()
+	defer arena.mu.Unlock()
+
+	if len(arena.nodes) == 0 {
+		arena.nodes = make([]Node, arenaNodes)
+	}
+	node := &arena.nodes[0]
+	arena.nodes = arena.nodes[1:]
+	return node
+}
+
+// extend returns a copy of sequence followed by move. Its capacity is its
+// length, so appending to it never writes into the sequence of another node.
+func (arena *nodeArena) extend(sequence []interface{}, move interface{}) []interface{} {
+	n := len(sequence) + 1
+
+	var extended []interface{}
+	if arena == nil || n > arenaMoves/8 {
+		extended = make([]interface{}, n)
+	} else {
+		arena.mu.Lock()
+		if len(arena.moves) < n {
+			arena.moves = make([]interface{}, arenaMoves)
+		}
+		extended = arena.moves[:n:n]
+		arena.moves = arena.moves[n:]
+		arena.mu.Unlock()
+	}
+
+	copy(extended, sequence)
+	extended[len(sequence)] = move
+	return extended
+}
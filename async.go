@@ -0,0 +1,85 @@
+package mcts
+
+import (
+	"context"
+	"sync"
+)
+
+// RunAsync starts the MCTS algorithm in the background and returns a
+// channel receiving a Result every time the best fitness improves. The
+// channel holds at most one pending result: an improvement found before the
+// previous one was received replaces it, so a slow reader only ever sees
+// the latest. Results sent during the search carry no Root, since the tree
+// is still growing. The final result is always sent, even when it does not
+// beat the last one, and is the last received before the channel is closed
+// once the search stops on MaxIterations, MaxDuration or ctx. It carries
+// Root, and Err when ctx stopped the search; when the configuration is
+// invalid it is the only result and carries nothing but Err.
+func RunAsync(
+	ctx context.Context,
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) <-chan Result {
+	stream := &resultStream{
+		results:  make(chan Result, 1),
+		maximize: config.Maximize,
+	}
+	config.onImprove = func(stats ProgressStats) {
+		stream.offer(false, Result{
+			BestSequence: stats.BestSequence,
+			BestFitness:  stats.BestFitness,
+			Iterations:   stats.Iterations,
+			TreeDepth:    stats.TreeDepth,
+			TotalNodes:   stats.TotalNodes,
+			Elapsed:      stats.Time,
+		})
+	}
+
+	go func() {
+		defer close(stream.results)
+		_, result, err := search(ctx, initialSequence, nextElements, fitnessFunc, config)
+		if result == nil {
+			result = &Result{}
+		}
+		result.Err = err
+		stream.offer(true, *result)
+	}()
+	return stream.results
+}
+
+// resultStream forwards improving results to a channel with a buffer of
+// one, dropping a pending result in favour of a newer one
+type resultStream struct {
+	results  chan Result
+	maximize bool
+
+	mu   sync.Mutex // Guards the fields below, root-parallel workers report concurrently
+	sent bool
+	best float64
+}
+
+// offer sends result unless it is not final and does not beat the last
+// result sent
+func (s *resultStream) offer(final bool, result Result) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !final && s.sent && !isBetter(s.maximize, result.BestFitness, s.best) {
+		return
+	}
+	s.sent = true
+	s.best = result.BestFitness
+
+	select {
+	case s.results <- result:
+	default:
+		// The reader has not taken the previous result yet, replace it
+		select {
+		case <-s.results:
+		default:
+		}
+		s.results <- result
+	}
+}
@@ -0,0 +1,40 @@
+package mcts
+
+// BackupStrategy chooses the value of a node that selection exploits
+type BackupStrategy string
+
+const (
+	// BackupMean exploits the mean fitness of the rollouts through a node
+	BackupMean BackupStrategy = "mean"
+	// BackupMax exploits the best fitness of the rollouts through a node,
+	// the lowest or the highest with Config.Maximize, so that a single
+	// great leaf is not diluted by its siblings. Suited to deterministic
+	// single-agent problems.
+	BackupMax BackupStrategy = "max"
+	// BackupMin exploits the worst fitness of the rollouts through a node,
+	// a pessimistic value suited to adversarial problems
+	BackupMin BackupStrategy = "min"
+	// BackupLast exploits the fitness of the latest rollout through a
+	// node, tracking non-stationary fitness functions
+	BackupLast BackupStrategy = "last"
+)
+
+// exploitation returns the value of node selection exploits under
+// config.BackupStrategy. Must be called with node.mu held on a visited node.
+func exploitation(node *Node, config *Config) float64 {
+	switch config.BackupStrategy {
+	case BackupMax:
+		if config.Maximize {
+			return node.maxFitness
+		}
+		return node.minFitness
+	case BackupMin:
+		if config.Maximize {
+			return node.minFitness
+		}
+		return node.maxFitness
+	case BackupLast:
+		return node.lastFitness
+	}
+	return node.totalFitness / float64(node.visits)
+}
@@ -0,0 +1,81 @@
+package mcts
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// BatchFitnessFunc evaluates several sequences at once, returning one
+// fitness per sequence in the same order
+type BatchFitnessFunc func(sequences [][]interface{}) []float64
+
+// defaultBatchSize is used when BatchFitness is set without a BatchSize
+const defaultBatchSize = 16
+
+// singleFitness evaluates a single sequence with batch, for the evaluations
+// made outside of the batched iterations. A call that does not return a
+// single value scores the sequence as the worst fitness.
+func singleFitness(batch BatchFitnessFunc, maximize bool) FitnessFunc {
+	return func(sequence []interface{}) float64 {
+		fitness := batch([][]interface{}{sequence})
+		if len(fitness) != 1 {
+			return worstFitness(maximize)
+		}
+		return fitness[0]
+	}
+}
+
+// batchedRollout is a simulated sequence waiting for its batch to be
+// evaluated
+type batchedRollout struct {
+	i        int
+	expanded *Node
+	sequence []interface{}
+	path     *inFlight
+}
+
+// iterateBatch claims up to config.BatchSize iterations and gathers their
+// rollouts, then evaluates them together with config.BatchFitness and
+// backpropagates them in order. Rollouts in flight keep their virtual
+// loss, so the gathered iterations spread over different paths. When
+// config.BatchFitness returns the wrong number of values, every rollout
+// of the batch is discarded like a failed FitnessResultFunc evaluation. It
+// returns false once the search has to stop.
+func (st *searchState) iterateBatch(rng *rand.Rand) bool {
+	var batch []batchedRollout
+	claimed := 0
+	for claimed < st.config.BatchSize {
+		i, start, ok := st.claim()
+		if !ok {
+			break
+		}
+		claimed++
+		expanded, sequence, path := st.rollout(i, start, rng)
+		if expanded == nil {
+			st.finish(i)
+			continue
+		}
+		batch = append(batch, batchedRollout{i: i, expanded: expanded, sequence: sequence, path: path})
+	}
+
+	if len(batch) > 0 {
+		sequences := make([][]interface{}, len(batch))
+		for j, rollout := range batch {
+			sequences[j] = rollout.sequence
+		}
+		fitness := st.batchFitness(sequences)
+		var err error
+		if len(fitness) != len(batch) {
+			err = fmt.Errorf("BatchFitness returned %d values for %d sequences", len(fitness), len(batch))
+		}
+		for j, rollout := range batch {
+			if err != nil {
+				st.discard(rollout.expanded, err, rollout.path)
+			} else {
+				st.backup(rollout.i, rollout.expanded, rollout.sequence, fitness[j], rollout.path)
+			}
+			st.finish(rollout.i)
+		}
+	}
+	return claimed == st.config.BatchSize
+}
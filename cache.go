@@ -0,0 +1,72 @@
+package mcts
+
+import (
+	"container/list"
+	"sync"
+)
+
+// priorCache is a least recently used cache of move priors keyed by state,
+// safe for use by parallel workers
+type priorCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // Most recently used first
+	entries  map[string]*list.Element
+}
+
+type priorCacheEntry struct {
+	key    string
+	priors []float64
+}
+
+func newPriorCache(capacity int) *priorCache {
+	return &priorCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *priorCache) get(key string) ([]float64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*priorCacheEntry).priors, true
+}
+
+func (c *priorCache) put(key string, priors []float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*priorCacheEntry).priors = priors
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&priorCacheEntry{key: key, priors: priors})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*priorCacheEntry).key)
+	}
+}
+
+// wrap returns a PriorFunc answering from the cache for states already seen
+// and computing priors with priorFunc otherwise
+func (c *priorCache) wrap(priorFunc PriorFunc, stateKey func(sequence []interface{}) string) PriorFunc {
+	return func(sequence []interface{}, moves []interface{}) []float64 {
+		key := stateKey(sequence)
+		if priors, ok := c.get(key); ok {
+			return priors
+		}
+		priors := priorFunc(sequence, moves)
+		c.put(key, priors)
+		return priors
+	}
+}
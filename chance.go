@@ -0,0 +1,46 @@
+package mcts
+
+import "math/rand"
+
+// isChance reports whether config.IsChanceNode marks sequence as a
+// position whose next move is drawn by config.ChanceOutcome
+func isChance(sequence []interface{}, config *Config) bool {
+	return config.IsChanceNode != nil && config.IsChanceNode(sequence)
+}
+
+// sampleChance descends from node through sampled outcomes for as long as
+// it reaches chance nodes, selecting among the children of every existing
+// outcome as usual. It returns the node reached, and the outcome child when
+// a sample first led to one that had to be created, which then takes the
+// place of an expansion. Outcomes on the way are added to path.
+func (st *searchState) sampleChance(node *Node, explorationConstant float64, bestFitness float64, rng *rand.Rand, path *inFlight) (*Node, *Node) {
+	for node.chance && !isSequenceComplete(node.sequence, st.config) {
+		outcome, created := sampleOutcome(node, &st.config, rng)
+		if created {
+			return node, outcome
+		}
+		path.add(outcome)
+		node = selection(outcome, explorationConstant, st.config, bestFitness, nil, path)
+	}
+	return node, nil
+}
+
+// sampleOutcome draws the next move of chance node with config.ChanceOutcome
+// and returns the child it leads to, creating it on first encounter.
+// Outcomes are visited as often as they are drawn, so the mean fitness of
+// the chance node weights each of them by its frequency.
+func sampleOutcome(node *Node, config *Config, rng *rand.Rand) (*Node, bool) {
+	move := config.ChanceOutcome(node.sequence, rng)
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	for _, child := range node.children {
+		if sameMove(child.sequence[len(child.sequence)-1], move) {
+			return child, false
+		}
+	}
+
+	sequence := config.nodes.extend(node.sequence, move)
+	return newChild(node, move, sequence, nil, config, nil, nil), true
+}
@@ -0,0 +1,82 @@
+package mcts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DAGNode is a single vertex of a DAG built from a set of sequences
+type DAGNode struct {
+	ID       int
+	Move     interface{} // Move on the edge leading into this node, nil for the root
+	Count    int         // Number of input sequences passing through this node
+	Children []*DAGNode
+}
+
+// DAG merges several sequences into a graph where shared prefixes are
+// collapsed into single nodes
+type DAG struct {
+	Root         *DAGNode
+	Nodes        []*DAGNode
+	MoveToString func(move interface{}) string // Optional edge label formatter, defaults to fmt.Sprint
+}
+
+// SequenceToGraph merges sequences into a DAG, treating two moves as the
+// same edge when equalFn reports them equal. A nil equalFn falls back to ==.
+func SequenceToGraph(sequences [][]interface{}, equalFn func(interface{}, interface{}) bool) *DAG {
+	if equalFn == nil {
+		equalFn = func(a, b interface{}) bool { return a == b }
+	}
+
+	dag := &DAG{}
+	dag.Root = dag.newNode(nil)
+
+	for _, sequence := range sequences {
+		node := dag.Root
+		node.Count++
+		for _, move := range sequence {
+			var next *DAGNode
+			for _, child := range node.Children {
+				if equalFn(child.Move, move) {
+					next = child
+					break
+				}
+			}
+			if next == nil {
+				next = dag.newNode(move)
+				node.Children = append(node.Children, next)
+			}
+			next.Count++
+			node = next
+		}
+	}
+
+	return dag
+}
+
+func (d *DAG) newNode(move interface{}) *DAGNode {
+	node := &DAGNode{ID: len(d.Nodes), Move: move}
+	d.Nodes = append(d.Nodes, node)
+	return node
+}
+
+// ToDOT renders the DAG in Graphviz DOT format
+func (d *DAG) ToDOT() string {
+	moveToString := d.MoveToString
+	if moveToString == nil {
+		moveToString = func(move interface{}) string { return fmt.Sprint(move) }
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph sequences {\n")
+	for _, node := range d.Nodes {
+		fmt.Fprintf(&b, "  n%d [label=\"%d\"];\n", node.ID, node.Count)
+	}
+	for _, node := range d.Nodes {
+		for _, child := range node.Children {
+			fmt.Fprintf(&b, "  n%d -> n%d [label=%q];\n", node.ID, child.ID, moveToString(child.Move))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
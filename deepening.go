@@ -0,0 +1,81 @@
+package mcts
+
+import (
+	"context"
+	"time"
+)
+
+// searchDeepening runs one search per sequence length from
+// config.MinSeqLength up to config.TargetSeqLength, each continuing the
+// tree of the previous one, and returns the best sequence over all of them.
+// The iteration and time budgets are split evenly across the lengths,
+// shorter lengths getting the remainder.
+func searchDeepening(
+	ctx context.Context,
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) (*Node, *Result, error) {
+	depths := config.TargetSeqLength - config.MinSeqLength + 1
+	startTime := time.Now()
+
+	var root *Node
+	var result *Result
+	var topK *topSequences
+	if config.TopK > 0 {
+		topK = newTopSequences(config.TopK, config)
+	}
+	iterations, fitnessErrors := 0, 0
+	var ctxErr error
+
+	for d := 0; d < depths; d++ {
+		depthConfig := config
+		depthConfig.MinSeqLength = 0
+		depthConfig.TargetSeqLength = config.MinSeqLength + d
+		depthConfig.MaxIterations = config.MaxIterations / depths
+		if d < config.MaxIterations%depths {
+			depthConfig.MaxIterations++
+		}
+		depthConfig.MaxDuration = config.MaxDuration / time.Duration(depths)
+		if root != nil {
+			depthConfig.ReuseTree = root
+		}
+		if config.MaxIterations > 0 && depthConfig.MaxIterations == 0 {
+			continue // Fewer iterations than lengths
+		}
+
+		var depthResult *Result
+		root, depthResult, ctxErr = search(ctx, initialSequence, nextElements, fitnessFunc, depthConfig)
+		if depthResult == nil {
+			return nil, nil, ctxErr // Invalid configuration
+		}
+
+		iterations += depthResult.Iterations
+		fitnessErrors += depthResult.FitnessErrors
+		if topK != nil {
+			for _, top := range depthResult.TopSequences {
+				topK.add(top.Sequence, top.Fitness)
+			}
+		}
+		if result == nil || isBetter(config.Maximize, depthResult.BestFitness, result.BestFitness) {
+			result = depthResult
+		}
+		result.Root = depthResult.Root
+		result.TreeDepth = depthResult.TreeDepth
+		result.TotalNodes = depthResult.TotalNodes
+		result.PrincipalVariation = depthResult.PrincipalVariation
+
+		if ctxErr != nil {
+			break
+		}
+	}
+
+	result.Iterations = iterations
+	result.FitnessErrors = fitnessErrors
+	result.Elapsed = time.Since(startTime)
+	if topK != nil {
+		result.TopSequences = topK.sorted()
+	}
+	return root, result, ctxErr
+}
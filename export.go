@@ -0,0 +1,138 @@
+package mcts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// ExportConfig selects the part of a search tree written by ExportDOT
+type ExportConfig struct {
+	MaxDepth   int    // Deepest level below the root written, 0 for no limit
+	MinVisits  int    // Nodes with fewer visits are left out with their subtrees
+	ColorByUCT bool   // Fill visited nodes by their UCT value among their siblings, from red (worst) to green (best)
+	Search     Config // Settings of the search that grew the tree, for SequenceToString and the UCT values
+}
+
+// ExportDOT writes the tree below root in Graphviz DOT format. Every node is
+// labeled with the move leading to it, formatted by
+// config.Search.SequenceToString or with %v, its visits and its mean
+// fitness, and every edge is drawn thicker the larger the share of the
+// parent's visits its child got. Nodes shared through transpositions are
+// written once, with an edge from every parent. The tree must not be
+// searched while it is exported.
+func ExportDOT(root *Node, w io.Writer, config ExportConfig) error {
+	if root == nil {
+		return fmt.Errorf("cannot export a nil root")
+	}
+
+	out := bufio.NewWriter(w)
+	ids := make(map[*Node]int)
+
+	var write func(node, parent *Node, depth int)
+	write = func(node, parent *Node, depth int) {
+		visits := node.Visits()
+		id := len(ids)
+		ids[node] = id
+		fmt.Fprintf(out, "  n%d [label=\"%s\"%s];\n", id, dotEscape(dotLabel(node, root, &config)), dotFill(node, parent, &config))
+
+		if config.MaxDepth > 0 && depth >= config.MaxDepth {
+			return
+		}
+		for _, child := range node.childrenSnapshot() {
+			if child.Visits() < config.MinVisits {
+				continue
+			}
+			if _, written := ids[child]; !written {
+				write(child, node, depth+1)
+			}
+			fmt.Fprintf(out, "  n%d -> n%d [penwidth=%.2f];\n", id, ids[child], dotPenWidth(child.Visits(), visits))
+		}
+	}
+
+	fmt.Fprintln(out, "digraph mcts {")
+	write(root, nil, 0)
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// WriteDOT writes the tree below root in Graphviz DOT format like
+// ExportDOT, down to maxDepth levels below the root, 0 for no limit. Pass
+// the config of the search so moves are labeled with its SequenceToString.
+func WriteDOT(w io.Writer, root *Node, config Config, maxDepth int) error {
+	return ExportDOT(root, w, ExportConfig{MaxDepth: maxDepth, Search: config})
+}
+
+// dotPenWidth returns the width of the edge to a child with visits out of
+// the parentVisits of its parent, from 1 for none to 5 for all of them
+func dotPenWidth(visits, parentVisits int) float64 {
+	if parentVisits == 0 {
+		return 1
+	}
+	return 1 + 4*math.Min(1, float64(visits)/float64(parentVisits))
+}
+
+// dotLabel describes a node by the move leading to it, its visits and its
+// mean fitness
+func dotLabel(node, root *Node, config *ExportConfig) string {
+	label := fmt.Sprintf("visits %d\nmean %.4g", node.Visits(), node.MeanFitness())
+	if node == root || len(node.sequence) == 0 {
+		return label
+	}
+	move := node.sequence[len(node.sequence)-1:]
+	if toString := config.Search.SequenceToString; toString != nil {
+		return toString(move) + "\n" + label
+	}
+	return fmt.Sprintf("%v\n%s", move[0], label)
+}
+
+// dotEscape escapes a label for a double-quoted DOT string
+func dotEscape(label string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(label)
+}
+
+// dotFill returns the fill attributes of a node colored by its UCT value
+// as a child of parent relative to its siblings, or nothing when colors are
+// off or the node has no siblings to compare with
+func dotFill(node, parent *Node, config *ExportConfig) string {
+	if !config.ColorByUCT || parent == nil || node.Visits() == 0 {
+		return ""
+	}
+
+	search := config.Search
+	if search.ExplorationConstant == 0 {
+		search.ExplorationConstant = defaultExplorationConstant
+	}
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+	exploration := depthExploration(parent, search.ExplorationConstant, &search)
+	uctOf := func(child *Node) (float64, bool) {
+		child.mu.Lock()
+		defer child.mu.Unlock()
+		if child.visits == 0 {
+			return 0, false
+		}
+		uct, _ := uctTermsUnder(parent, child, exploration, &search)
+		return uct, true
+	}
+
+	value, _ := uctOf(node)
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, sibling := range parent.children {
+		if uct, ok := uctOf(sibling); ok {
+			lowest, highest = math.Min(lowest, uct), math.Max(highest, uct)
+		}
+	}
+	if highest <= lowest {
+		return ""
+	}
+
+	// Selection prefers the lowest value, or the highest when maximizing
+	score := (highest - value) / (highest - lowest)
+	if search.Maximize {
+		score = 1 - score
+	}
+	return fmt.Sprintf(`, style=filled, fillcolor="%.3f 0.5 1.0"`, score/3)
+}
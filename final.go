@@ -0,0 +1,156 @@
+package mcts
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// FinalSelectionBestFitness follows the child with the best exploited
+	// value, the mean fitness under the default BackupStrategy
+	FinalSelectionBestFitness = "best_fitness"
+	// FinalSelectionMostVisits follows the most visited child, the robust
+	// child of the MCTS literature
+	FinalSelectionMostVisits = "most_visits"
+	// FinalSelectionMixed follows the child with the best combined rank by
+	// visits and by value, ties going to the more visited child
+	FinalSelectionMixed = "mixed"
+)
+
+// finalSequence follows the children chosen by config.FinalSelectionCriteria
+// from root down to a leaf, sampling the root child by sampleByVisits when
+// config.Temperature is positive. It returns best when that rollout passes
+// through the leaf, and otherwise the leaf's sequence greedily completed
+// with its fitness.
+func finalSequence(
+	root *Node,
+	best []interface{},
+	bestFitness float64,
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) ([]interface{}, float64) {
+	node := root
+	if config.Temperature > 0 {
+		if child := sampleByVisits(root, config.Temperature, finalRand(config)); child != nil {
+			node = child
+		}
+	}
+	for {
+		child := selectBestChild(node, config.FinalSelectionCriteria, &config)
+		if child == nil {
+			break
+		}
+		node = child
+	}
+	if node == root || isPrefix(node.sequence, best) {
+		return best, bestFitness
+	}
+
+	sequence := parallelBuildSequence(node.sequence, nextElements, fitnessFunc, config)
+	return sequence, fitnessFunc(sequence)
+}
+
+// selectBestChild returns the visited child of node preferred by criteria,
+// one of the FinalSelection constants, or nil when no child was visited
+func selectBestChild(node *Node, criteria string, config *Config) *Node {
+	ranked := rankChildren(node, criteria, config)
+	if len(ranked) == 0 {
+		return nil
+	}
+	return ranked[0]
+}
+
+// rankChildren returns the visited children of node from the most to the
+// least preferred by criteria, one of the FinalSelection constants
+func rankChildren(node *Node, criteria string, config *Config) []*Node {
+	type candidate struct {
+		node   *Node
+		visits int
+		value  float64
+	}
+	var visited []candidate
+	for _, child := range node.childrenSnapshot() {
+		child.mu.Lock()
+		if child.visits > 0 {
+			visited = append(visited, candidate{child, child.visits, exploitation(child, config)})
+		}
+		child.mu.Unlock()
+	}
+
+	byVisits := func(i, j int) bool { return visited[i].visits > visited[j].visits }
+	byValue := func(i, j int) bool { return isBetter(config.Maximize, visited[i].value, visited[j].value) }
+
+	switch criteria {
+	case FinalSelectionBestFitness:
+		sort.SliceStable(visited, byValue)
+	case FinalSelectionMixed:
+		ranks := make(map[*Node]int, len(visited))
+		sort.SliceStable(visited, byValue)
+		for rank, child := range visited {
+			ranks[child.node] = rank
+		}
+		sort.SliceStable(visited, byVisits)
+		for rank, child := range visited {
+			ranks[child.node] += rank
+		}
+		sort.SliceStable(visited, func(i, j int) bool { return ranks[visited[i].node] < ranks[visited[j].node] })
+	default:
+		sort.SliceStable(visited, byVisits)
+	}
+
+	ranked := make([]*Node, len(visited))
+	for i, child := range visited {
+		ranked[i] = child.node
+	}
+	return ranked
+}
+
+// sampleByVisits draws a visited child of node with probability
+// proportional to its visits raised to 1/temperature, or returns nil when
+// no child was visited. The weights are taken relative to the most visited
+// child so that low temperatures do not overflow.
+func sampleByVisits(node *Node, temperature float64, rng *rand.Rand) *Node {
+	mostVisits := 0
+	for _, child := range node.children {
+		if child.visits > mostVisits {
+			mostVisits = child.visits
+		}
+	}
+	if mostVisits == 0 {
+		return nil
+	}
+
+	weights := make([]float64, len(node.children))
+	total := 0.0
+	for i, child := range node.children {
+		if child.visits > 0 {
+			weights[i] = math.Exp(math.Log(float64(child.visits)/float64(mostVisits)) / temperature)
+			total += weights[i]
+		}
+	}
+
+	r := rng.Float64() * total
+	var chosen *Node
+	for i, child := range node.children {
+		if weights[i] == 0 {
+			continue
+		}
+		chosen = child
+		if r < weights[i] {
+			break
+		}
+		r -= weights[i]
+	}
+	return chosen
+}
+
+// finalRand returns the random source the final move is sampled from under
+// Temperature, config.Rand when it is set
+func finalRand(config Config) *rand.Rand {
+	if config.Rand != nil {
+		return config.Rand
+	}
+	return rand.New(rand.NewSource(config.RandomSeed))
+}
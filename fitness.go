@@ -0,0 +1,43 @@
+package mcts
+
+// FitnessResult is the outcome of evaluating a sequence with a
+// FitnessResultFunc, Value being ignored when Err is set
+type FitnessResult struct {
+	Value float64
+	Err   error
+}
+
+// FitnessResultFunc evaluates a sequence like FitnessFunc, but can report
+// that the evaluation failed
+type FitnessResultFunc func(sequence []interface{}) FitnessResult
+
+// resultFitness adapts fn to a FitnessFunc for the evaluations made outside
+// of rollouts, scoring a failed evaluation as the worst fitness
+func resultFitness(fn FitnessResultFunc, maximize bool) FitnessFunc {
+	return func(sequence []interface{}) float64 {
+		result := fn(sequence)
+		if result.Err != nil {
+			return worstFitness(maximize)
+		}
+		return result.Value
+	}
+}
+
+// discard drops the rollout from expanded whose evaluation failed with err
+// instead of backpropagating it, clearing the virtual loss on its path. A node that was just added is removed from
+// the tree along with its move, so the search does not keep coming back to
+// an evaluation that fails.
+func (st *searchState) discard(expanded *Node, err error, path *inFlight) {
+	path.release()
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.fitnessErrors++
+	if st.config.DebugLevel > 0 {
+		st.config.logger().Printf("Skipping %v, its evaluation failed: %v\n", expanded.sequence, err)
+	}
+	if expanded != st.root && expanded.Visits() == 0 {
+		st.prune(expanded, false)
+	}
+}
@@ -0,0 +1,66 @@
+package mcts
+
+// IncrementalFitnessFunc returns the fitness of parentSeq followed by move,
+// derived from parentFitness, the fitness of parentSeq
+type IncrementalFitnessFunc func(parentFitness float64, parentSeq []interface{}, move interface{}) float64
+
+// initFitness records the fitness of node's sequence when it is created
+// below parent, which must be locked, so rollouts from it can start there
+func initFitness(node, parent *Node, config *Config) {
+	if config.IncrementalFitness == nil || !parent.fitnessKnown {
+		return
+	}
+	move := node.sequence[len(node.sequence)-1]
+	node.fitness = config.IncrementalFitness(parent.fitness, parent.sequence, move)
+	node.fitnessKnown = true
+}
+
+// nodeFitness returns the fitness of node's sequence under
+// config.IncrementalFitness, folding the moves below the nearest ancestor
+// that recorded its own, which the root of a search always does
+func nodeFitness(node *Node, config *Config) float64 {
+	if node.fitnessKnown || node.parent == nil {
+		return node.fitness
+	}
+	parent := node.parent
+	return config.IncrementalFitness(nodeFitness(parent, config), parent.sequence, node.sequence[len(node.sequence)-1])
+}
+
+// evaluate returns the fitness of sequence, simulated from expanded, or the
+// error config.FitnessResultFunc failed with. Under config.IncrementalFitness
+// only the simulated moves are applied, one at a time, to the fitness of
+// expanded. Under config.EnableMemoization successful evaluations are
+// cached like those of the fitness function.
+func (st *searchState) evaluate(expanded *Node, sequence []interface{}) (float64, error) {
+	if st.config.FitnessResultFunc == nil && st.config.IncrementalFitness == nil {
+		return st.fitnessFunc(sequence), nil // Already memoized
+	}
+	var key string
+	if st.memo != nil {
+		cachedKey, value, ok := st.memo.lookup(sequence)
+		if ok {
+			return value, nil
+		}
+		key = cachedKey
+	}
+	fitness, err := st.evaluateUncached(expanded, sequence)
+	if st.memo != nil && err == nil {
+		st.memo.values.Store(key, fitness)
+	}
+	return fitness, err
+}
+
+func (st *searchState) evaluateUncached(expanded *Node, sequence []interface{}) (float64, error) {
+	if st.config.FitnessResultFunc != nil {
+		result := st.config.FitnessResultFunc(sequence)
+		return result.Value, result.Err
+	}
+	if st.config.IncrementalFitness == nil {
+		return st.fitnessFunc(sequence), nil
+	}
+	fitness := nodeFitness(expanded, &st.config)
+	for i := len(expanded.sequence); i < len(sequence); i++ {
+		fitness = st.config.IncrementalFitness(fitness, sequence[:i:i], sequence[i])
+	}
+	return fitness, nil
+}
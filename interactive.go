@@ -0,0 +1,127 @@
+package mcts
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// defaultInteractiveInterval is used when InteractiveMode is enabled
+// without an InteractiveInterval
+const defaultInteractiveInterval = 100
+
+// Input and output used by InteractiveMode, replaceable in tests
+var (
+	interactiveInput  io.Reader = os.Stdin
+	interactiveOutput io.Writer = os.Stdout
+)
+
+// DebugDump writes an indented view of the tree below node, one line per
+// node with its last move, visit count and mean fitness
+func DebugDump(w io.Writer, node *Node) {
+	debugDump(w, node, 0)
+}
+
+func debugDump(w io.Writer, node *Node, depth int) {
+	move := "root"
+	if depth > 0 && len(node.sequence) > 0 {
+		move = fmt.Sprint(node.sequence[len(node.sequence)-1])
+	}
+
+	mean := 0.0
+	if node.visits > 0 {
+		mean = node.totalFitness / float64(node.visits)
+	}
+	fmt.Fprintf(w, "%s%s visits=%d mean=%f\n", strings.Repeat("  ", depth), move, node.visits, mean)
+
+	for _, child := range node.children {
+		debugDump(w, child, depth+1)
+	}
+}
+
+// interactiveSession reads moves typed by a human between iterations
+type interactiveSession struct {
+	scanner *bufio.Scanner
+	auto    bool
+}
+
+func newInteractiveSession() *interactiveSession {
+	return &interactiveSession{scanner: bufio.NewScanner(interactiveInput)}
+}
+
+// pause prints the tree and handles one line of input. A valid root move is
+// force-expanded, "auto" resumes without further pauses and "quit" makes
+// pause return true so the search stops.
+func (s *interactiveSession) pause(st *searchState) bool {
+	root := st.root
+	DebugDump(interactiveOutput, root)
+	fmt.Fprint(interactiveOutput, "move, auto or quit> ")
+
+	if !s.scanner.Scan() {
+		s.auto = true
+		return false
+	}
+
+	input := strings.TrimSpace(s.scanner.Text())
+	switch input {
+	case "":
+		return false
+	case "quit":
+		return true
+	case "auto":
+		s.auto = true
+		return false
+	}
+
+	for _, move := range st.nextElements(root.sequence) {
+		if fmt.Sprint(move) == input {
+			st.forceExpand(root, move)
+			return false
+		}
+	}
+
+	fmt.Fprintf(interactiveOutput, "invalid move %q\n", input)
+	return false
+}
+
+// forceExpand adds move as a child of node unless it is already expanded,
+// created like any other node of the search and counted against MaxNodes
+func (st *searchState) forceExpand(node *Node, move interface{}) *Node {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	for _, child := range node.children {
+		if sameMove(child.sequence[len(child.sequence)-1], move) {
+			return child
+		}
+	}
+
+	// Generate the other moves first, a node with children counts as
+	// having generated them already
+	if len(node.unusedMoves) == 0 && len(node.children) == 0 {
+		node.unusedMoves = st.nextElements(node.sequence)
+	}
+	for i, unused := range node.unusedMoves {
+		if sameMove(unused, move) {
+			node.unusedMoves = append(node.unusedMoves[:i], node.unusedMoves[i+1:]...)
+			break
+		}
+	}
+
+	sequence := st.config.nodes.extend(node.sequence, move)
+	var key interface{}
+	if st.transpositions != nil {
+		key = transpositionKey(sequence, &st.config)
+		if existing := adoptTransposition(node, sequence, key, st.transpositions, &st.config); existing != nil {
+			return existing
+		}
+	}
+
+	child := newChild(node, move, sequence, st.nextElements, &st.config, st.transpositions, key)
+	st.observeDepth(child)
+	atomic.AddInt64(&st.nodes, 1)
+	return child
+}
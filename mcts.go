@@ -1,254 +1,1686 @@
 package mcts
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"math/rand"
+	"reflect"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Node represents a state in the MCTS tree
 type Node struct {
-	sequence     []interface{}
-	parent       *Node
-	children     []*Node
-	visits       int
-	totalFitness float64
-	mu           sync.Mutex
-	unusedMoves  []interface{}
+	sequence          []interface{}
+	parent            *Node
+	children          []*Node
+	depth             int  // Distance from the root the node was created under, set once at creation
+	chance            bool // Whether Config.IsChanceNode marks the node, its children are then sampled outcomes
+	visits            int
+	totalFitness      float64
+	sumSquaredFitness float64
+	minFitness        float64 // Lowest and highest fitness backpropagated through the node
+	maxFitness        float64
+	lastFitness       float64 // Latest fitness backpropagated through the node
+	mu                sync.Mutex
+	unusedMoves       []interface{}
+	virtualLoss       int32 // Simulations in flight through this node, accessed atomically
+	amafVisits        int   // All-moves-as-first statistics, only maintained under RAVE
+	amafFitness       float64
+	prior             float64       // Prior probability of the move leading here, only set under PUCT
+	priorMoves        []interface{} // Moves the priors of the children were computed for
+	priors            []float64
+	fitness           float64 // Fitness of the sequence under Config.IncrementalFitness, when fitnessKnown
+	fitnessKnown      bool
+	Metadata          interface{} // Free for the caller's own data, typically set by Config.NodeInit; not saved by Tree.MarshalJSON
+}
+
+// Visits returns the number of simulations backpropagated through the node
+func (node *Node) Visits() int {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	return node.visits
+}
+
+// MeanFitness returns the average fitness backpropagated through the node,
+// or 0 if it was never visited
+func (node *Node) MeanFitness() float64 {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.visits == 0 {
+		return 0
+	}
+	return node.totalFitness / float64(node.visits)
+}
+
+// Variance returns the variance of the fitness backpropagated through the
+// node, or 0 if it was visited less than twice
+func (node *Node) Variance() float64 {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.visits < 2 {
+		return 0
+	}
+	mean := node.totalFitness / float64(node.visits)
+	return math.Max(0, node.sumSquaredFitness/float64(node.visits)-mean*mean)
+}
+
+// Sequence returns a copy of the sequence the node represents
+func (node *Node) Sequence() []interface{} {
+	sequence := make([]interface{}, len(node.sequence))
+	copy(sequence, node.sequence)
+	return sequence
+}
+
+// Children returns the expanded children of the node
+func (node *Node) Children() []*Node {
+	return node.childrenSnapshot()
 }
 
 // Config holds the MCTS configuration parameters
 type Config struct {
-	ExplorationConstant  float64
-	MaxIterations        int
-	TargetSeqLength      int // Set to -1 to use IsSequenceTerminated instead
-	RandomSeed           int64
-	DebugLevel           int
-	IsSequenceTerminated func(sequence []interface{}) bool
-	SequenceToString     func(sequence []interface{}) string // New field for custom sequence string conversion
+	ExplorationConstant    float64
+	MaxIterations          int
+	MaxDuration            time.Duration // Optional wall-clock budget, the search stops at whichever limit is hit first; MaxIterations of 0 means no iteration limit
+	TargetSeqLength        int           // Set to -1 to use IsSequenceTerminated instead
+	RandomSeed             int64
+	DebugLevel             int
+	IsSequenceTerminated   func(sequence []interface{}) bool
+	SequenceToString       func(sequence []interface{}) string        // New field for custom sequence string conversion
+	RolloutPrefix          func(sequence []interface{}) []interface{} // Optional moves replayed at the start of each rollout
+	FitnessBound           func(sequence []interface{}) float64       // Optional optimistic bound on the fitness reachable from a sequence (lower bound, or upper bound with Maximize)
+	FitnessRankTransform   bool                                       // Backpropagate the rank of each fitness among all observed values, scaled to [0,1]
+	InteractiveMode        bool                                       // Pause every InteractiveInterval iterations to let a human inject root moves via stdin
+	InteractiveInterval    int                                        // Iterations between interactive pauses, defaults to 100
+	TracedIteration        int                                        // Log every selection step of this iteration (counted from 1), 0 disables tracing
+	Logger                 Logger                                     // Destination for traces and progress reports, defaults to stdout
+	Parallelism            int                                        // Number of goroutines running iterations concurrently, defaults to 1
+	GuaranteeFullExpansion bool                                       // Try every move of a node before descending past it even under first-play urgency, which selection otherwise always does
+	Policy                 SelectionPolicy                            // Child scoring used during selection, defaults to PolicyUCT
+	SelectFunc             SelectFunc                                 // Optional choice of the child to descend into during selection, replacing Policy and UCTVariant
+	RAVEBias               float64                                    // How long AMAF estimates keep their weight under PolicyRAVE, smaller trusts them longer
+	FitnessComponents      []FitnessFunc                              // Optional objectives combined into the fitness as a weighted sum, replacing the fitness function
+	FitnessWeights         []float64                                  // Weight of each entry of FitnessComponents
+	Maximize               bool                                       // Treat higher fitness as better, the default is minimization
+	UCTVariant             string                                     // Exploration formula used in selection: UCTVariantUCB1 (default), UCTVariantUCB1Tuned or UCTVariantPUCT
+	PriorFunc              PriorFunc                                  // Optional prior probability of each move under UCTVariantPUCT, defaults to uniform
+	LazyRootExpansion      bool                                       // Defer computing the root's moves until its first expansion instead of before the search starts
+	ActionMaskFunc         func(depth int, move interface{}) bool     // Optional filter on the moves of nextElements, false excludes move from position depth of the sequence
+	FilterFunc             FilterFunc                                 // Optional pruning of the moves of nextElements with the whole sequence at hand, applied after ActionMaskFunc
+	NodeInit               func(node *Node, sequence []interface{})   // Optional hook called on every node added to the tree, typically to set its Metadata; called with the parent locked, so it must not call methods of the parent
+	ProgressiveWidening    bool                                       // Cap the children of a node at floor(PWConstant * visits^PWAlpha) to keep wide trees from staying shallow
+	PWAlpha                float64                                    // Growth exponent of the progressive widening cap, defaults to 0.5
+	PWConstant             float64                                    // Scale of the progressive widening cap, defaults to 1
+	Allocator              BudgetAllocator                            // Optional per-subtree iteration budgets, replacing selection from the root while they last
+	AllocationInterval     int                                        // Iterations between Allocator calls, defaults to 100
+	StateKey               func(sequence []interface{}) string        // Optional key of the state a sequence leads to, for the Searcher prior cache and Transpositions
+	Transpositions         bool                                       // Share a single node between sequences of equal length and StateKey; forces a single goroutine
+	PriorCacheSize         int                                        // Number of states whose PriorFunc results a Searcher caches by StateKey, 0 disables the cache
+	HashFunc               func(sequence []interface{}) uint64        // Optional state hash, sequences of equal length and hash share a single node; forces a single goroutine
+	OnIteration            func(i int, stats ProgressStats)           // Optional hook called after every iteration with a snapshot of the search, concurrently when Parallelism is above 1
+	FitnessThreshold       float64                                    // Fitness considered good enough to stop at, see StopOnThreshold
+	StopOnThreshold        bool                                       // Stop the search as soon as a sequence reaches FitnessThreshold
+	ReuseTree              *Node                                      // Optional tree from an earlier search, usually from AdvanceRoot, to continue instead of starting from initialSequence
+	RolloutPolicy          RolloutPolicyFunc                          // Optional choice of the next rollout move among moves, uniform random when nil
+	MoveWeightFunc         MoveWeightFunc                             // Optional non-negative weight of a rollout move, random rollout moves are then drawn in proportion to it
+	MaxSimulationDepth     int                                        // Maximum number of moves a rollout appends, 0 means no limit; truncated rollouts are evaluated but never become the best sequence
+	MaxDepth               int                                        // Maximum number of moves below the root, 0 means no limit; sequences that deep are terminal, evaluated as complete without growing the tree past them
+	IsChanceNode           func(sequence []interface{}) bool          // Optional test for positions whose next move is random rather than chosen, requires ChanceOutcome
+	ChanceOutcome          ChanceOutcomeFunc                          // Draws the next move after a sequence IsChanceNode marks, in selection and rollouts alike
+	MaxNodes               int                                        // Maximum number of nodes kept in the tree, 0 means no limit; subtrees chosen by PrunePolicy are removed past it
+	PrunePolicy            PrunePolicy                                // Chooses the subtrees removed under MaxNodes, defaults to FewestVisitsPrune
+	PruneThreshold         float64                                    // When above 0, periodically remove subtrees whose best fitness is worse than the best found by more than this fraction of it
+	PruneInterval          int                                        // Iterations between PruneThreshold sweeps, defaults to 100
+	FitnessResultFunc      FitnessResultFunc                          // Optional fitness that can fail, used instead of the fitness function; rollouts whose evaluation fails are skipped
+	IncrementalFitness     IncrementalFitnessFunc                     // Optional fitness of a sequence derived from that of the sequence without its last move, used in place of the fitness function to score rollouts
+	BatchFitness           BatchFitnessFunc                           // Optional evaluation of several rollouts at once, used instead of the fitness function during the search
+	BatchSize              int                                        // Rollouts gathered before each BatchFitness call, defaults to 16
+	TabuFunc               func(sequence []interface{}) bool          // Optional test for sequences never to be played, rollouts backtrack around them and expansion skips them
+	RolloutEpsilon         float64                                    // Probability of a random rollout move instead of the RolloutPolicy move, 0 always follows the policy
+	TopK                   int                                        // Number of best distinct complete sequences reported in Result.TopSequences, 0 disables them
+	BackupStrategy         BackupStrategy                             // Value exploited by selection: BackupMean (default), BackupMax, BackupMin or BackupLast
+	Rand                   *rand.Rand                                 // Optional random source used instead of one seeded from RandomSeed, parallel workers are seeded from it
+	EnableMemoization      bool                                       // Cache fitness values by SequenceKey so that repeated sequences are evaluated once per search
+	SequenceKey            func(sequence []interface{}) string        // Key of a sequence for EnableMemoization, defaults to fmt.Sprint of the sequence
+	OnProgress             func(stats ProgressStats)                  // Optional hook called every ProgressInterval iterations with a snapshot of the search, independently of DebugLevel
+	ProgressInterval       int                                        // Iterations between OnProgress calls, defaults to 100
+	DiscountFactor         float64                                    // Factor in (0, 1] applied to the backpropagated fitness once per move between a node and the end of the rollout, 0 or 1 disables it
+	ExplorationDecay       float64                                    // Factor in (0, 1] applied to ExplorationConstant once per iteration, 0 keeps the constant fixed
+	MinExplorationConstant float64                                    // Floor of the exploration constant under ExplorationDecay
+	DepthExploration       []float64                                  // Optional exploration constant of each depth, indexed by the length of the sequence of the node selected from; depths past its end use ExplorationConstant
+	VirtualLoss            float64                                    // Fitness counted for every simulation in flight through a node (negated with Maximize) when Parallelism is above 1, 0 only shrinks their exploration bonus
+	MinVisitsBeforeUCT     int                                        // Visits, counting simulations in flight, a child is forced to get before selection scores it by UCT, 0 or 1 only forces unvisited children
+	NormalizeRewards       bool                                       // Rescale the exploitation term of UCT to [0,1] by the lowest and highest fitness backpropagated so far, so one ExplorationConstant suits any fitness scale
+	FinalSelectionCriteria string                                     // How the returned sequence is chosen: "" for the best rollout (default), or FinalSelectionBestFitness, FinalSelectionMostVisits or FinalSelectionMixed to follow the tree
+	Temperature            float64                                    // When positive, sample the root move with probability proportional to visits^(1/Temperature) and follow FinalSelectionCriteria, most visits by default, below it; 0 keeps the choice deterministic
+	UseFirstPlayUrgency    bool                                       // Score untried moves at FirstPlayUrgency instead of always trying them before visited children
+	FirstPlayUrgency       float64                                    // Estimated value of an untried move under UseFirstPlayUrgency, a selection stops to expand a node when no child scores better
+	FPUReduction           float64                                    // When non-zero, untried moves are estimated under UseFirstPlayUrgency at the value of their parent made worse by it instead of at FirstPlayUrgency, negative to make them look better
+	MinSeqLength           int                                        // Search every length from MinSeqLength up to TargetSeqLength in turn, each continuing the previous tree with an even share of the budget; 0 searches TargetSeqLength only
+	RootParallel           bool                                       // Grow Parallelism independent trees seeded RandomSeed + worker and merge their root children, instead of sharing one tree
+	MergeTrees             bool                                       // Under RootParallel, join the whole trees depth-first instead of their root children and follow FinalSelectionCriteria, most visits by default, down the merged tree
+
+	rewardBounds *rewardBounds             // Set by the search with NormalizeRewards
+	horizon      int                       // Length of the sequences at MaxDepth, set by the search
+	onImprove    func(stats ProgressStats) // Set by RunAsync, called with st.mu held whenever the best fitness improves
+	nodes        *nodeArena                // Set by the search, allocates the nodes added to the tree
 }
 
+const defaultExplorationConstant = 1.41
+
+// defaultProgressInterval is used when OnProgress is set without a
+// ProgressInterval
+const defaultProgressInterval = 100
+
+// Progressive widening defaults, allowing sqrt(visits) children
+const (
+	defaultPWConstant = 1.0
+	defaultPWAlpha    = 0.5
+)
+
 type NextElementsFunc func(sequence []interface{}) []interface{}
 type FitnessFunc func(sequence []interface{}) float64
 
+// RolloutPolicyFunc chooses the next move of a rollout among moves, the
+// moves nextElements allows after sequence, or returns nil to play a
+// random move instead
+type RolloutPolicyFunc func(sequence []interface{}, moves []interface{}) interface{}
+
+// MoveWeightFunc returns the non-negative weight of playing move after
+// sequence in a rollout
+type MoveWeightFunc func(sequence []interface{}, move interface{}) float64
+
+// SelectFunc chooses the child of parent a selection descends into among
+// children, or returns nil to stop and expand parent, which skips the
+// iteration when parent has no untried move left. explorationConstant is
+// the one in effect at the depth of parent. Nodes are only to be read
+// through their exported getters.
+type SelectFunc func(parent *Node, children []*Node, explorationConstant float64) *Node
+
+// FilterFunc returns the moves to keep among moves, the moves nextElements
+// generated after sequence
+type FilterFunc func(sequence []interface{}, moves []interface{}) []interface{}
+
+// ChanceOutcomeFunc draws the next move after sequence, a position
+// Config.IsChanceNode marks as random, from rng
+type ChanceOutcomeFunc func(sequence []interface{}, rng *rand.Rand) interface{}
+
+// Logger receives diagnostic output from the search
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+type stdoutLogger struct{}
+
+func (stdoutLogger) Printf(format string, args ...interface{}) {
+	fmt.Printf(format, args...)
+}
+
+// logger returns config.Logger, falling back to stdout
+func (config Config) logger() Logger {
+	if config.Logger != nil {
+		return config.Logger
+	}
+	return stdoutLogger{}
+}
+
 // isSequenceComplete checks if the sequence should stop growing
 func isSequenceComplete(sequence []interface{}, config Config) bool {
+	if atHorizon(sequence, &config) {
+		return true
+	}
 	if config.TargetSeqLength != -1 {
 		return len(sequence) >= config.TargetSeqLength
 	}
 	return config.IsSequenceTerminated != nil && config.IsSequenceTerminated(sequence)
 }
 
-// Run executes the MCTS algorithm
+// atHorizon reports whether sequence is config.MaxDepth moves below the
+// root of the search, where the tree stops growing
+func atHorizon(sequence []interface{}, config *Config) bool {
+	return config.horizon > 0 && len(sequence) >= config.horizon
+}
+
+// Run executes the MCTS algorithm. Use RunContext to stop the search early
+// on cancellation or a deadline.
 func Run(
 	initialSequence []interface{},
 	nextElements NextElementsFunc,
 	fitnessFunc FitnessFunc,
 	config Config,
 ) ([]interface{}, error) {
-	if config.ExplorationConstant == 0 {
-		config.ExplorationConstant = 1.41
+	return RunContext(context.Background(), initialSequence, nextElements, fitnessFunc, config)
+}
+
+// RunContext executes the MCTS algorithm until config.MaxIterations is reached
+// or ctx is done. On cancellation it returns the best sequence found so far
+// together with ctx.Err(), so callers can tell a cut-short search apart from a
+// normal completion, which returns a nil error.
+func RunContext(
+	ctx context.Context,
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) ([]interface{}, error) {
+	result, err := RunDetailed(ctx, initialSequence, nextElements, fitnessFunc, config)
+	if result == nil {
+		return nil, err
+	}
+	return result.BestSequence, err
+}
+
+// Result describes the outcome of a search
+type Result struct {
+	BestSequence []interface{}
+	BestFitness  float64
+	Iterations   int
+	TreeDepth    int
+	TotalNodes   int
+	Elapsed      time.Duration
+	Root         *Node            // Root of the final search tree, for inspection
+	Components   []float64        // Value of each of Config.FitnessComponents for BestSequence, unweighted
+	TopSequences []SequenceResult // Best distinct complete sequences rolled out, best first, only with Config.TopK
+
+	PrincipalVariation []interface{} // Moves below Root along the most visited children, see PrincipalVariation
+	FitnessErrors      int           // Rollouts skipped because Config.FitnessResultFunc failed to evaluate them, or Config.BatchFitness returned the wrong number of values
+	Terminal           bool          // The initial sequence was already complete or had no moves, so it was returned without searching
+	Err                error         // Why the search stopped early or did not start, only set on the final result of RunAsync
+}
+
+// RunDetailed behaves like RunContext but also reports the fitness of the
+// returned sequence and how much work the search did. The result is nil
+// only when the configuration is invalid.
+func RunDetailed(
+	ctx context.Context,
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) (*Result, error) {
+	_, result, err := search(ctx, initialSequence, nextElements, fitnessFunc, config)
+	return result, err
+}
+
+// search runs the MCTS loop and returns the root of the search tree along
+// with the result of the search. The search continues config.ReuseTree when
+// it is set, ignoring initialSequence. With config.MinSeqLength it deepens
+// the tree one sequence length at a time, and with config.RootParallel it
+// grows one independent tree per worker instead.
+func search(
+	ctx context.Context,
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) (*Node, *Result, error) {
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if config.MinSeqLength > 0 {
+		return searchDeepening(ctx, initialSequence, nextElements, fitnessFunc, config)
+	}
+	if config.RootParallel && config.Parallelism > 1 && !config.InteractiveMode {
+		return searchRootParallel(ctx, initialSequence, nextElements, fitnessFunc, config)
+	}
+	if config.ReuseTree != nil {
+		return searchFrom(ctx, config.ReuseTree, nextElements, fitnessFunc, config)
 	}
+	return searchFrom(ctx, &Node{sequence: initialSequence}, nextElements, fitnessFunc, config)
+}
 
-	if config.TargetSeqLength == -1 && config.IsSequenceTerminated == nil {
-		return nil, fmt.Errorf("when TargetSeqLength is -1, IsSequenceTerminated function must be provided")
+// searchFrom runs the MCTS loop growing the tree below root, which may
+// already hold statistics from an earlier search
+func searchFrom(
+	ctx context.Context,
+	root *Node,
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) (*Node, *Result, error) {
+	if config.ExplorationConstant == 0 {
+		config.ExplorationConstant = defaultExplorationConstant
+	}
+	if config.MaxDepth > 0 {
+		config.horizon = len(root.sequence) + config.MaxDepth
+	}
+	// A block of the arena stays allocated while any of its nodes is in the
+	// tree, so pruned nodes would not free memory under MaxNodes or
+	// PruneThreshold
+	config.nodes = nil
+	if config.MaxNodes <= 0 && config.PruneThreshold <= 0 {
+		config.nodes = &nodeArena{}
 	}
+	root.chance = isChance(root.sequence, &config)
 
-	rand.Seed(config.RandomSeed)
-	startTime := time.Now()
-	lastPrintTime := startTime
+	if config.BatchFitness != nil && config.BatchSize <= 0 {
+		config.BatchSize = defaultBatchSize
+	}
+	fitnessFunc = searchFitness(fitnessFunc, config)
 
-	root := &Node{
-		sequence:    initialSequence,
-		unusedMoves: nextElements(initialSequence),
+	batchFitness := config.BatchFitness
+	var memo *fitnessMemo
+	if config.EnableMemoization {
+		memo = newFitnessMemo(config.SequenceKey)
+		fitnessFunc = memo.wrap(fitnessFunc)
+		if batchFitness != nil {
+			batchFitness = memo.wrapBatch(batchFitness)
+		}
 	}
 
-	var bestSequence []interface{}
-	bestFitness := math.MaxFloat64
+	nextElements = searchMoves(nextElements, config)
 
-	// Main MCTS loop
-	for i := 0; i < config.MaxIterations; i++ {
-		// Selection phase
-		selected := selection(root, config.ExplorationConstant, config)
+	workers := config.Parallelism
+	if workers < 1 || config.InteractiveMode || usesTranspositions(&config) {
+		workers = 1
+	}
 
-		// Expansion phase
-		expanded := expansion(selected, nextElements)
-		if expanded == nil {
-			continue // Skip if expansion wasn't possible
+	startTime := time.Now()
+
+	initRoot(root, nextElements, config)
+	if config.IncrementalFitness != nil && !root.fitnessKnown {
+		root.fitness, root.fitnessKnown = fitnessFunc(root.sequence), true
+	}
+	if isTerminalRoot(root, config) {
+		if config.DebugLevel > 0 {
+			config.logger().Printf("Initial sequence %v has no moves left, returning it without searching\n", root.sequence)
 		}
+		return root, terminalResult(root, fitnessFunc, config, startTime), nil
+	}
 
-		// Simulation phase
-		simulatedSeq := simulation(expanded, nextElements, config)
-		fitness := fitnessFunc(simulatedSeq)
+	st := &searchState{
+		ctx:           ctx,
+		nextElements:  nextElements,
+		fitnessFunc:   fitnessFunc,
+		batchFitness:  batchFitness,
+		memo:          memo,
+		config:        config,
+		root:          root,
+		parallel:      workers > 1 || (config.BatchFitness != nil && config.BatchSize > 1),
+		startTime:     startTime,
+		lastPrintTime: startTime,
+		bestFitness:   worstFitness(config.Maximize),
+		nodes:         int64(countNodes(root)),
+		treeDepth:     int64(getTreeDepth(root)),
+	}
 
-		// Backpropagation phase
-		backpropagate(expanded, fitness)
+	if config.InteractiveMode {
+		st.interactive = newInteractiveSession()
+		if st.config.InteractiveInterval <= 0 {
+			st.config.InteractiveInterval = defaultInteractiveInterval
+		}
+	}
+	if usesTranspositions(&config) {
+		st.transpositions = &sync.Map{}
+	}
+	if config.TopK > 0 {
+		st.topK = newTopSequences(config.TopK, config)
+	}
+	if config.NormalizeRewards {
+		st.config.rewardBounds = newRewardBounds()
+		if root.visits > 0 {
+			st.config.rewardBounds.observe(root.minFitness)
+			st.config.rewardBounds.observe(root.maxFitness)
+		}
+	}
+	if config.OnProgress != nil && st.config.ProgressInterval <= 0 {
+		st.config.ProgressInterval = defaultProgressInterval
+	}
+	if config.PruneThreshold > 0 && st.config.PruneInterval <= 0 {
+		st.config.PruneInterval = defaultPruneInterval
+	}
+	if config.Allocator != nil && st.config.AllocationInterval <= 0 {
+		st.config.AllocationInterval = defaultAllocationInterval
+	}
 
-		// Update best found solution
-		if isSequenceComplete(simulatedSeq, config) && fitness < bestFitness {
-			bestFitness = fitness
-			bestSequence = make([]interface{}, len(simulatedSeq))
-			copy(bestSequence, simulatedSeq)
+	// Main MCTS loop, run by every worker with its own random source
+	work := func(rng *rand.Rand) {
+		if config.BatchFitness != nil {
+			for st.iterateBatch(rng) {
+			}
+			return
+		}
+		for {
+			i, start, ok := st.claim()
+			if !ok {
+				return
+			}
+			st.iterate(i, start, rng)
 		}
+	}
 
-		// Progress reporting
-		if config.DebugLevel > 0 && time.Since(lastPrintTime) > 1*time.Second {
-			stats := ProgressStats{
-				Iterations:   i + 1,
-				BestFitness:  bestFitness,
-				BestSequence: bestSequence,
-				TreeDepth:    getTreeDepth(root),
-				TotalNodes:   countNodes(root),
-				Time:         time.Since(startTime),
+	if workers == 1 {
+		rng := config.Rand
+		if rng == nil {
+			rng = rand.New(rand.NewSource(config.RandomSeed))
+		}
+		work(rng)
+	} else {
+		// A rand.Rand is not safe for concurrent use, so every worker gets
+		// its own source
+		seeds := make([]int64, workers)
+		for w := range seeds {
+			seeds[w] = config.RandomSeed + int64(w)
+			if config.Rand != nil {
+				seeds[w] = config.Rand.Int63()
 			}
-			printProgress(stats, config)
-			lastPrintTime = time.Now()
 		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				work(rand.New(rand.NewSource(seeds[w])))
+			}(w)
+		}
+		wg.Wait()
 	}
 
+	bestSequence, bestFitness := st.bestSequence, st.bestFitness
+
 	// If no valid sequence was found, build one
 	if bestSequence == nil {
-		bestSequence = buildSequence(initialSequence, nextElements, config)
+		bestSequence = parallelBuildSequence(root.sequence, nextElements, fitnessFunc, config)
+		bestFitness = fitnessFunc(bestSequence)
+	}
+	if config.FinalSelectionCriteria != "" || config.Temperature > 0 {
+		bestSequence, bestFitness = finalSequence(root, bestSequence, bestFitness, nextElements, fitnessFunc, config)
+	}
+
+	result := &Result{
+		BestSequence: bestSequence,
+		BestFitness:  bestFitness,
+		Iterations:   st.iterations,
+		TreeDepth:    getTreeDepth(root),
+		TotalNodes:   countNodes(root),
+		Elapsed:      time.Since(startTime),
+		Root:         root,
+
+		PrincipalVariation: PrincipalVariation(root),
+		FitnessErrors:      st.fitnessErrors,
+	}
+	for _, component := range config.FitnessComponents {
+		result.Components = append(result.Components, component(bestSequence))
+	}
+	if st.topK != nil {
+		result.TopSequences = st.topK.sorted()
+	}
+	return root, result, st.ctxErr
+}
+
+// searchState is the state of a search shared by all of its workers
+type searchState struct {
+	ctx            context.Context
+	nextElements   NextElementsFunc
+	fitnessFunc    FitnessFunc
+	batchFitness   BatchFitnessFunc // Only used with BatchFitness
+	memo           *fitnessMemo     // Only used with EnableMemoization
+	config         Config
+	root           *Node
+	parallel       bool // Apply virtual loss while iterations are in flight
+	interactive    *interactiveSession
+	startTime      time.Time
+	transpositions *sync.Map // Nodes by transpositionKey, only used with HashFunc or Transpositions
+	nodes          int64     // Nodes in the tree, accessed atomically
+	treeDepth      int64     // Deepest node reached below root, accessed atomically
+
+	mu              sync.Mutex // Guards the fields below
+	iterations      int
+	stopped         bool
+	ctxErr          error
+	lastPrintTime   time.Time
+	bestSequence    []interface{}
+	bestFitness     float64
+	observedFitness []float64          // Sorted, only used with FitnessRankTransform
+	allocation      []allocatedSubtree // Budgets of the latest Allocator call
+	topK            *topSequences      // Only used with TopK
+	fitnessErrors   int                // Rollouts discarded after a FitnessResultFunc error
+}
+
+// claim returns the index of the next iteration to run and the node its
+// selection starts from, or false once the search has to stop
+func (st *searchState) claim() (int, *Node, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if st.stopped {
+		return 0, nil, false
+	}
+
+	i := st.iterations
+	switch {
+	case st.config.MaxIterations > 0 && i >= st.config.MaxIterations:
+		st.stopped = true
+	case st.ctx.Err() != nil:
+		st.ctxErr = st.ctx.Err()
+		st.stopped = true
+	case st.config.MaxDuration > 0 && time.Since(st.startTime) >= st.config.MaxDuration:
+		st.stopped = true
+	case st.interactive != nil && !st.interactive.auto && i > 0 && i%st.config.InteractiveInterval == 0:
+		st.stopped = st.interactive.pause(st)
+	}
+	if st.stopped {
+		return 0, nil, false
+	}
+
+	if st.config.Allocator != nil && i%st.config.AllocationInterval == 0 {
+		st.allocate(i)
+	}
+
+	st.iterations++
+	return i, st.nextStart(), true
+}
+
+// iterate runs a single selection, expansion, simulation and
+// backpropagation pass, selecting from start down
+func (st *searchState) iterate(i int, start *Node, rng *rand.Rand) {
+	defer st.finish(i)
+	expanded, simulatedSeq, path := st.rollout(i, start, rng)
+	if expanded == nil {
+		return
+	}
+	fitness, err := st.evaluate(expanded, simulatedSeq)
+	if err != nil {
+		st.discard(expanded, err, path)
+		return
+	}
+	st.backup(i, expanded, simulatedSeq, fitness, path)
+}
+
+// finish calls the hooks due after iteration i
+func (st *searchState) finish(i int) {
+	if st.config.OnProgress != nil && (i+1)%st.config.ProgressInterval == 0 {
+		st.report(i)
+	}
+	if st.config.OnIteration != nil {
+		st.notify(i)
+	}
+}
+
+// rollout runs the selection, expansion and simulation phases of iteration
+// i from start down. It returns the node the simulation started from, the
+// simulated sequence and the nodes holding its virtual loss, or a nil node
+// when expansion wasn't possible.
+func (st *searchState) rollout(i int, start *Node, rng *rand.Rand) (*Node, []interface{}, *inFlight) {
+	config := st.config
+
+	st.mu.Lock()
+	bestFitness := st.bestFitness
+	st.mu.Unlock()
+
+	// Selection phase
+	var trace Logger
+	if i+1 == config.TracedIteration {
+		trace = config.logger()
+	}
+	var path *inFlight
+	if st.parallel {
+		path = &inFlight{}
+		for node := start; node.parent != nil; node = node.parent {
+			path.add(node) // As selection would have on the way down from the root
+		}
+	}
+	exploration := decayedExploration(&config, i)
+	selected := selection(start, exploration, config, bestFitness, trace, path)
+	selected, expanded := st.sampleChance(selected, exploration, bestFitness, rng, path)
+
+	// Expansion phase, unless a chance outcome was just added. A complete
+	// node, including one at MaxDepth, is terminal and evaluated again
+	// instead.
+	terminal := expanded == nil && isSequenceComplete(selected.sequence, config)
+	if terminal {
+		expanded = selected
+	} else if expanded == nil {
+		expanded = expansion(selected, st.nextElements, config, bestFitness, rng, st.transpositions)
+	}
+	for expanded == nil && config.ProgressiveWidening {
+		// Another worker reached the widening cap first, descend among the
+		// existing children instead of wasting the iteration
+		next := selection(selected, exploration, config, bestFitness, nil, path)
+		if next == selected {
+			break
+		}
+		if selected, expanded = st.sampleChance(next, exploration, bestFitness, rng, path); expanded != nil {
+			break
+		}
+		if isSequenceComplete(selected.sequence, config) {
+			expanded, terminal = selected, true
+			break
+		}
+		expanded = expansion(selected, st.nextElements, config, bestFitness, rng, st.transpositions)
+	}
+	if expanded == nil {
+		path.release()
+		return nil, nil, nil // Skip if expansion wasn't possible
+	}
+	if !terminal {
+		st.observeDepth(expanded)
+		if st.transpositions == nil || expanded.Visits() == 0 {
+			atomic.AddInt64(&st.nodes, 1) // Adopted transpositions were already counted
+		}
+		path.add(expanded) // Selection already marked a terminal node
+	}
+
+	// Simulation phase
+	return expanded, simulation(expanded, st.nextElements, config, rng), path
+}
+
+// backup runs the backpropagation phase of iteration i for the rollout
+// simulatedSeq from expanded, clears the virtual loss on its path and
+// records it if it is the best so far
+func (st *searchState) backup(i int, expanded *Node, simulatedSeq []interface{}, fitness float64, path *inFlight) {
+	config := st.config
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// Backpropagation phase
+	value := fitness
+	if config.FitnessRankTransform {
+		st.observedFitness, value = rankFitness(st.observedFitness, fitness)
+	}
+	if config.DiscountFactor > 0 && config.DiscountFactor < 1 {
+		// Every node is credited with the fitness discounted by the moves
+		// between it and the end of the rollout
+		if config.rewardBounds != nil {
+			config.rewardBounds.observe(discount(value, len(simulatedSeq)-len(expanded.sequence), &config))
+			config.rewardBounds.observe(discount(value, len(simulatedSeq)-len(st.root.sequence), &config))
+		}
+		backpropagateDiscounted(expanded, value, simulatedSeq, &config)
+		value = discount(value, len(simulatedSeq)-len(expanded.sequence), &config)
+	} else {
+		if config.rewardBounds != nil {
+			config.rewardBounds.observe(value)
+		}
+		backpropagate(expanded, value)
+	}
+	path.release()
+	if usesRAVE(&config) {
+		updateAMAF(expanded, simulatedSeq, value)
+	}
+	if config.MaxNodes > 0 {
+		st.enforceMaxNodes()
+	}
+
+	if st.topK != nil && isSequenceComplete(simulatedSeq, config) {
+		st.topK.add(simulatedSeq, fitness)
+	}
+
+	// Update best found solution
+	if isSequenceComplete(simulatedSeq, config) && isBetter(config.Maximize, fitness, st.bestFitness) {
+		st.bestFitness = fitness
+		st.bestSequence = make([]interface{}, len(simulatedSeq))
+		copy(st.bestSequence, simulatedSeq)
+		if config.onImprove != nil {
+			config.onImprove(st.progressStats(i))
+		}
+
+		// Stop early once the target fitness is reached
+		if config.StopOnThreshold && !st.stopped && !isBetter(config.Maximize, config.FitnessThreshold, fitness) {
+			st.stopped = true
+			if config.DebugLevel > 0 {
+				config.logger().Printf("Reached fitness threshold %f after %d iterations: %f\n", config.FitnessThreshold, i+1, fitness)
+			}
+		}
+	}
+
+	if config.PruneThreshold > 0 && (i+1)%config.PruneInterval == 0 {
+		st.pruneUncompetitive()
+	}
+
+	// Progress reporting
+	if config.DebugLevel > 0 && time.Since(st.lastPrintTime) > 1*time.Second {
+		printProgress(st.progressStats(i), config)
+		st.lastPrintTime = time.Now()
+	}
+}
+
+// progressStats describes the search after iteration i. Must be called
+// with st.mu held.
+func (st *searchState) progressStats(i int) ProgressStats {
+	bestSequence := make([]interface{}, len(st.bestSequence))
+	copy(bestSequence, st.bestSequence)
+	stats := ProgressStats{
+		Iterations:   i + 1,
+		BestFitness:  st.bestFitness,
+		BestSequence: bestSequence,
+		TreeDepth:    int(atomic.LoadInt64(&st.treeDepth)),
+		TotalNodes:   int(atomic.LoadInt64(&st.nodes)),
+		Time:         time.Since(st.startTime),
 	}
+	if st.memo != nil {
+		stats.CacheHitRate = st.memo.hitRate()
+	}
+	return stats
+}
+
+// observeDepth raises the tracked tree depth to that of node, so progress
+// reports do not walk the whole tree
+func (st *searchState) observeDepth(node *Node) {
+	depth := int64(node.depth - st.root.depth)
+	for {
+		current := atomic.LoadInt64(&st.treeDepth)
+		if depth <= current || atomic.CompareAndSwapInt64(&st.treeDepth, current, depth) {
+			return
+		}
+	}
+}
+
+// notify passes the stats after iteration i to config.OnIteration, outside
+// of st.mu so a slow callback does not hold up other workers
+func (st *searchState) notify(i int) {
+	st.mu.Lock()
+	stats := st.progressStats(i)
+	st.mu.Unlock()
+	st.config.OnIteration(i, stats)
+}
 
-	return bestSequence, nil
+// report passes the stats after iteration i to config.OnProgress, outside
+// of st.mu like notify
+func (st *searchState) report(i int) {
+	st.mu.Lock()
+	stats := st.progressStats(i)
+	st.mu.Unlock()
+	st.config.OnProgress(stats)
 }
 
-func selection(node *Node, explorationConstant float64, config Config) *Node {
-	for !isSequenceComplete(node.sequence, config) && len(node.children) > 0 {
+// selection descends from node to the most urgent node to expand. When
+// trace is non-nil every step is logged to it as a SelectionStep. Every
+// node on the way down is added to path, when non-nil, as having a
+// simulation in flight.
+func selection(node *Node, explorationConstant float64, config Config, bestFitness float64, trace Logger, path *inFlight) *Node {
+	for depth := 0; !isSequenceComplete(node.sequence, config); depth++ {
 		node.mu.Lock()
+		// Stop at the shallowest node with an untried move, under progressive
+		// widening only while the cap allows another child. First-play
+		// urgency scores untried moves against the children instead, unless
+		// every move is forced.
+		expandable := len(node.unusedMoves) > 0 &&
+			(!config.ProgressiveWidening || len(node.children) < widenLimit(node, config))
+		_, urgent := firstPlayUrgency(node, &config)
+		forced := expandable && (!urgent || config.GuaranteeFullExpansion || config.ProgressiveWidening)
+		if len(node.children) == 0 || node.chance || forced {
+			node.mu.Unlock()
+			break
+		}
+
 		var selected *Node
-		bestUCT := math.MaxFloat64
+		bestUCT := worstFitness(config.Maximize)
+
+		var step *SelectionStep
+		if trace != nil {
+			step = &SelectionStep{Depth: depth, Sequence: node.sequence}
+		}
+
+		if config.SelectFunc != nil {
+			selected = customSelection(node, explorationConstant, &config, bestFitness)
+		} else {
+			for _, child := range node.children {
+				if isPruned(child.sequence, &config, bestFitness) {
+					continue
+				}
 
-		for _, child := range node.children {
-			child.mu.Lock()
-			uct := calculateUCT(child, explorationConstant)
-			child.mu.Unlock()
+				child.mu.Lock()
+				exploration := depthExploration(node, explorationConstant, &config)
+				uct := scoreChild(child, exploration, &config)
+				if step != nil {
+					step.Candidates = append(step.Candidates, scoreCandidate(child, exploration, &config, uct))
+				}
+				child.mu.Unlock()
 
-			if uct < bestUCT {
-				bestUCT = uct
-				selected = child
+				if isBetter(config.Maximize, uct, bestUCT) {
+					bestUCT = uct
+					selected = child
+				}
+			}
+			if urgency, ok := firstPlayUrgency(node, &config); selected != nil && ok && expandable && !isBetter(config.Maximize, bestUCT, urgency) {
+				selected = nil // An untried move is estimated at least as good, expand it here
 			}
 		}
+		if selected != nil && selected.parent != node && config.HashFunc != nil {
+			// A transposition shared with another parent, backpropagate along this path
+			// (StateKey transpositions keep their first parent instead)
+			selected.mu.Lock()
+			selected.parent = node
+			selected.mu.Unlock()
+		}
 		node.mu.Unlock()
 
+		if step != nil {
+			if selected != nil {
+				step.Chosen = selected.sequence[len(selected.sequence)-1]
+			}
+			step.log(trace)
+		}
+
 		if selected == nil {
 			break
 		}
+		path.add(selected)
 		node = selected
 	}
 	return node
 }
 
-// calculateUCT remains unchanged
-func calculateUCT(node *Node, explorationConstant float64) float64 {
+// customSelection returns the child of node chosen by config.SelectFunc
+// among the children not pruned by config.FitnessBound, or nil when there
+// is none or the function chose none of them. Must be called with node.mu
+// held, which is released while config.SelectFunc runs so it can use the
+// getters of node.
+func customSelection(node *Node, explorationConstant float64, config *Config, bestFitness float64) *Node {
+	var candidates []*Node
+	for _, child := range node.children {
+		if !isPruned(child.sequence, config, bestFitness) {
+			candidates = append(candidates, child)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	exploration := depthExploration(node, explorationConstant, config)
+
+	node.mu.Unlock()
+	chosen := config.SelectFunc(node, candidates, exploration)
+	node.mu.Lock()
+
+	for _, candidate := range candidates {
+		if candidate == chosen {
+			return chosen
+		}
+	}
+	return nil
+}
+
+// calculateUCT scores a child for selection with the exploration formula
+// of config.UCTVariant, lower is better unless config.Maximize is set.
+// Simulations still in flight count as visits, shrinking the exploration
+// bonus so that parallel workers spread out instead of piling onto the same
+// path, and with config.VirtualLoss they also make the node look worse.
+func calculateUCT(node *Node, explorationConstant float64, config *Config) float64 {
+	score, _ := uctTerms(node, explorationConstant, config)
+	return score
+}
+
+// uctTerms returns the score of calculateUCT along with the exploration
+// term it includes, which is 0 while node is unvisited or forced by
+// config.MinVisitsBeforeUCT. Must be called with node.mu held.
+func uctTerms(node *Node, explorationConstant float64, config *Config) (float64, float64) {
+	return uctTermsUnder(node.parent, node, explorationConstant, config)
+}
+
+// uctTermsUnder is uctTerms for node as a child of parent, which differs
+// from node.parent for a node shared through transpositions. Must be called
+// with node.mu held.
+func uctTermsUnder(parent, node *Node, explorationConstant float64, config *Config) (float64, float64) {
+	sign := 1.0
+	if config.Maximize {
+		sign = -1.0
+	}
+
+	virtual := int(atomic.LoadInt32(&node.virtualLoss))
 	if node.visits == 0 {
+		if virtual > 0 {
+			return sign * math.MaxFloat64 / 2, 0 // Already being simulated, prefer any other child
+		}
+		if parent != nil {
+			if urgency, ok := firstPlayUrgency(parent, config); ok {
+				return urgency, 0
+			}
+		}
+		return -sign * math.MaxFloat64, 0
+	}
+	if node.visits+virtual < config.MinVisitsBeforeUCT {
+		// Still forced, the child with the fewest visits first
+		return -sign * math.MaxFloat64 / float64(node.visits+virtual+1), 0
+	}
+
+	exploration := explorationBonus(node, parent, explorationConstant, config, node.visits+virtual)
+	exploit := exploitation(node, config)
+	if virtual > 0 && config.VirtualLoss > 0 {
+		// Count every simulation in flight as a rollout of fitness VirtualLoss,
+		// or -VirtualLoss when maximizing
+		exploit = (exploit*float64(node.visits) + sign*config.VirtualLoss*float64(virtual)) / float64(node.visits+virtual)
+	}
+	if config.rewardBounds != nil {
+		exploit = config.rewardBounds.normalize(exploit)
+	}
+	return exploit - sign*exploration, exploration
+}
+
+// firstPlayUrgency returns the score of an untried move of node, and false
+// when untried moves are not scored and always come first. Under
+// UseFirstPlayUrgency it is the value of node made worse by FPUReduction
+// when that is set, and FirstPlayUrgency otherwise. Must be called with
+// node.mu held.
+func firstPlayUrgency(node *Node, config *Config) (float64, bool) {
+	if !config.UseFirstPlayUrgency {
+		return 0, false
+	}
+	if config.FPUReduction != 0 {
+		if node.visits == 0 {
+			return 0, false
+		}
+		value := exploitation(node, config)
+		if config.rewardBounds != nil {
+			value = config.rewardBounds.normalize(value)
+		}
+		if config.Maximize {
+			return value - config.FPUReduction, true
+		}
+		return value + config.FPUReduction, true
+	}
+	return config.FirstPlayUrgency, true
+}
+
+// depthExploration returns the exploration constant for choosing among the
+// children of node, config.DepthExploration[len(node.sequence)] when it has
+// that many entries and explorationConstant otherwise
+func depthExploration(node *Node, explorationConstant float64, config *Config) float64 {
+	if depth := len(node.sequence); depth < len(config.DepthExploration) {
+		return config.DepthExploration[depth]
+	}
+	return explorationConstant
+}
+
+// decayedExploration returns the exploration constant of iteration i,
+// ExplorationConstant * ExplorationDecay^i but no less than
+// MinExplorationConstant
+func decayedExploration(config *Config, i int) float64 {
+	if config.ExplorationDecay <= 0 {
+		return config.ExplorationConstant
+	}
+	decayed := config.ExplorationConstant * math.Pow(config.ExplorationDecay, float64(i))
+	return math.Max(config.MinExplorationConstant, decayed)
+}
+
+// isTerminalRoot reports whether a search from root has nothing to do: root
+// has not been expanded and its sequence is complete or, unless
+// config.LazyRootExpansion deferred generating them, has no moves
+func isTerminalRoot(root *Node, config Config) bool {
+	if len(root.children) > 0 || root.chance {
+		return false
+	}
+	if isSequenceComplete(root.sequence, config) {
+		return true
+	}
+	return !config.LazyRootExpansion && len(root.unusedMoves) == 0
+}
+
+// terminalResult is the result of a search from a terminal root, holding
+// its own sequence as the best one
+func terminalResult(root *Node, fitnessFunc FitnessFunc, config Config, startTime time.Time) *Result {
+	bestSequence := root.Sequence()
+	result := &Result{
+		BestSequence: bestSequence,
+		BestFitness:  fitnessFunc(bestSequence),
+		TotalNodes:   1,
+		Elapsed:      time.Since(startTime),
+		Root:         root,
+		Terminal:     true,
+	}
+	for _, component := range config.FitnessComponents {
+		result.Components = append(result.Components, component(bestSequence))
+	}
+	return result
+}
+
+// initRoot populates the moves of a fresh root before the search starts,
+// unless config.LazyRootExpansion leaves that to its first expansion
+func initRoot(root *Node, nextElements NextElementsFunc, config Config) {
+	if config.LazyRootExpansion {
+		return
+	}
+	if len(root.children) == 0 && len(root.unusedMoves) == 0 {
+		root.unusedMoves = nextElements(root.sequence)
+	}
+}
+
+// widenLimit returns how many children node may have under progressive
+// widening, floor(PWConstant * visits^PWAlpha) but at least one. Must be
+// called with node.mu held.
+func widenLimit(node *Node, config Config) int {
+	c := config.PWConstant
+	if c == 0 {
+		c = defaultPWConstant
+	}
+	alpha := config.PWAlpha
+	if alpha == 0 {
+		alpha = defaultPWAlpha
+	}
+
+	limit := int(math.Floor(c * math.Pow(float64(node.visits), alpha)))
+	if limit < 1 {
+		return 1
+	}
+	return limit
+}
+
+// isBetter reports whether fitness a beats fitness b, higher being better
+// when maximize is set
+func isBetter(maximize bool, a, b float64) bool {
+	if maximize {
+		return a > b
+	}
+	return a < b
+}
+
+// worstFitness returns the fitness every real value beats
+func worstFitness(maximize bool) float64 {
+	if maximize {
 		return -math.MaxFloat64
 	}
+	return math.MaxFloat64
+}
 
-	exploitation := node.totalFitness / float64(node.visits)
-	exploration := explorationConstant * math.Sqrt(math.Log(float64(node.parent.visits))/float64(node.visits))
-	return exploitation - exploration
+// isPruned reports whether config.FitnessBound proves that no completion of
+// sequence can beat bestFitness
+func isPruned(sequence []interface{}, config *Config, bestFitness float64) bool {
+	return config.FitnessBound != nil && !isBetter(config.Maximize, config.FitnessBound(sequence), bestFitness)
 }
 
-// expansion remains unchanged
-func expansion(node *Node, nextElements NextElementsFunc) *Node {
+// expansion adds a random untried move as a new child, discarding moves
+// that are pruned by config.FitnessBound or tabu under config.TabuFunc. With a transpositions table, a
+// move leading to a state already in the tree reuses its node instead.
+// Returns nil when node has no untried move left.
+func expansion(node *Node, nextElements NextElementsFunc, config Config, bestFitness float64, rng *rand.Rand, transpositions *sync.Map) *Node {
 	node.mu.Lock()
 	defer node.mu.Unlock()
 
-	if len(node.unusedMoves) == 0 {
-		node.unusedMoves = nextElements(node.sequence)
+	if config.ProgressiveWidening && len(node.children) >= widenLimit(node, config) {
+		return nil
 	}
 
-	if len(node.unusedMoves) == 0 {
-		return nil
+	// A node with children has generated its moves already, so once none is
+	// left unused every one of them is expanded
+	if len(node.unusedMoves) == 0 && len(node.children) == 0 {
+		node.unusedMoves = nextElements(node.sequence)
 	}
 
-	moveIndex := rand.Intn(len(node.unusedMoves))
-	move := node.unusedMoves[moveIndex]
+	for len(node.unusedMoves) > 0 {
+		moveIndex := rng.Intn(len(node.unusedMoves))
+		move := node.unusedMoves[moveIndex]
+
+		node.unusedMoves[moveIndex] = node.unusedMoves[len(node.unusedMoves)-1]
+		node.unusedMoves = node.unusedMoves[:len(node.unusedMoves)-1]
+
+		newSequence := config.nodes.extend(node.sequence, move)
+		if isPruned(newSequence, &config, bestFitness) || isTabu(newSequence, &config) {
+			continue
+		}
 
-	node.unusedMoves[moveIndex] = node.unusedMoves[len(node.unusedMoves)-1]
-	node.unusedMoves = node.unusedMoves[:len(node.unusedMoves)-1]
+		var key interface{}
+		if transpositions != nil {
+			key = transpositionKey(newSequence, &config)
+			if existing := adoptTransposition(node, newSequence, key, transpositions, &config); existing != nil {
+				return existing
+			}
+		}
 
-	newSequence := make([]interface{}, len(node.sequence)+1)
-	copy(newSequence, node.sequence)
-	newSequence[len(node.sequence)] = move
+		return newChild(node, move, newSequence, nextElements, &config, transpositions, key)
+	}
 
-	child := &Node{
-		sequence: newSequence,
-		parent:   node,
+	return nil
+}
+
+// newChild adds the node reached from node by move, whose sequence is
+// sequence, to the children of node. Every node below the root is created
+// here, so it gets its PUCT prior, incremental fitness and NodeInit whether
+// it was expanded, sampled as a chance outcome or forced interactively.
+// With transpositions it is registered under key. Must be called with
+// node.mu held.
+func newChild(node *Node, move interface{}, sequence []interface{}, nextElements NextElementsFunc, config *Config, transpositions *sync.Map, key interface{}) *Node {
+	child := config.nodes.node()
+	child.sequence = sequence
+	child.parent = node
+	child.depth = node.depth + 1
+	child.chance = isChance(sequence, config)
+	if config.UCTVariant == UCTVariantPUCT && !node.chance {
+		child.prior = movePrior(node, move, nextElements, *config)
+	}
+	initFitness(child, node, config)
+	if config.NodeInit != nil {
+		config.NodeInit(child, sequence)
+	}
+	if transpositions != nil {
+		transpositions.Store(key, child)
 	}
 
 	node.children = append(node.children, child)
 	return child
 }
 
-func simulation(node *Node, nextElements NextElementsFunc, config Config) []interface{} {
+func simulation(node *Node, nextElements NextElementsFunc, config Config, rng *rand.Rand) []interface{} {
 	sequence := make([]interface{}, len(node.sequence))
 	copy(sequence, node.sequence)
 
-	for !isSequenceComplete(sequence, config) {
-		moves := nextElements(sequence)
+	// Moves may only be appended up to this length under MaxSimulationDepth
+	limit := -1
+	if config.MaxSimulationDepth > 0 {
+		limit = len(sequence) + config.MaxSimulationDepth
+	}
+
+	if config.RolloutPrefix != nil {
+		sequence = applyRolloutPrefix(sequence, nextElements, config, limit)
+	}
+	if config.TabuFunc != nil {
+		return tabuRollout(sequence, nextElements, &config, rng, limit)
+	}
+
+	for !isSequenceComplete(sequence, config) && len(sequence) != limit {
+		if isChance(sequence, &config) {
+			sequence = append(sequence, config.ChanceOutcome(sequence, rng))
+			continue
+		}
+		var moves []interface{}
+		if len(sequence) == len(node.sequence) {
+			moves = startMoves(node, nextElements)
+		} else {
+			moves = nextElements(sequence)
+		}
 		if len(moves) == 0 {
 			break
 		}
-		move := moves[rand.Intn(len(moves))]
-		sequence = append(sequence, move)
+		sequence = append(sequence, rolloutMove(sequence, moves, &config, rng))
+	}
+
+	return sequence
+}
+
+// startMoves returns the moves after node for the first step of a rollout
+// from it. A node without children keeps them as its unused moves, so that
+// expanding it later does not generate them again; a node with children
+// has already given some of them away and generates them anew.
+func startMoves(node *Node, nextElements NextElementsFunc) []interface{} {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	if len(node.children) > 0 {
+		return nextElements(node.sequence)
+	}
+	if len(node.unusedMoves) == 0 {
+		node.unusedMoves = nextElements(node.sequence)
+	}
+	// Expansion reorders the unused moves in place, the rollout gets a copy
+	return append([]interface{}(nil), node.unusedMoves...)
+}
+
+// rolloutMove picks the next move of a rollout with config.RolloutPolicy,
+// falling back to randomMove when there is no policy, with probability
+// config.RolloutEpsilon, when the policy returns nil to leave the choice to
+// chance, or when it returns a move that is not among moves
+func rolloutMove(sequence []interface{}, moves []interface{}, config *Config, rng *rand.Rand) interface{} {
+	if config.RolloutPolicy != nil && (config.RolloutEpsilon <= 0 || rng.Float64() >= config.RolloutEpsilon) {
+		move := config.RolloutPolicy(sequence, moves)
+		if containsMove(moves, move) {
+			return move
+		}
+		if move != nil && config.DebugLevel > 0 {
+			config.logger().Printf("RolloutPolicy returned %v, which is not one of %v; playing a random move\n", move, moves)
+		}
 	}
+	return randomMove(sequence, moves, config, rng)
+}
+
+// randomMove draws one of moves, uniformly unless config.MoveWeightFunc
+// weights them. Negative and NaN weights count as 0.
+func randomMove(sequence []interface{}, moves []interface{}, config *Config, rng *rand.Rand) interface{} {
+	var weights []float64
+	if config.MoveWeightFunc != nil {
+		weights = make([]float64, len(moves))
+		for i, move := range moves {
+			if weight := config.MoveWeightFunc(sequence, move); weight > 0 {
+				weights[i] = weight
+			}
+		}
+	}
+	return weightedMove(moves, weights, rng)
+}
+
+// weightedMove draws one of moves in proportion to weights, which must not
+// be negative, or uniformly when weights is nil or has no positive entry
+func weightedMove(moves []interface{}, weights []float64, rng *rand.Rand) interface{} {
+	total := 0.0
+	last := 0 // Last move with a positive weight
+	for i, weight := range weights {
+		if weight > 0 {
+			total += weight
+			last = i
+		}
+	}
+	if total <= 0 || math.IsInf(total, 1) {
+		return moves[rng.Intn(len(moves))]
+	}
+
+	r := rng.Float64() * total
+	for i, weight := range weights {
+		if r < weight {
+			return moves[i]
+		}
+		r -= weight
+	}
+	return moves[last] // Rounding left r just past the last weight
+}
 
+// applyRolloutPrefix replays the moves returned by config.RolloutPrefix,
+// stopping at the first move that nextElements does not allow or once the
+// sequence reaches limit moves, unless limit is negative
+func applyRolloutPrefix(sequence []interface{}, nextElements NextElementsFunc, config Config, limit int) []interface{} {
+	for _, move := range config.RolloutPrefix(sequence) {
+		if isSequenceComplete(sequence, config) || len(sequence) == limit || !containsMove(nextElements(sequence), move) {
+			break
+		}
+		sequence = append(sequence, move)
+	}
 	return sequence
 }
 
-// backpropagate remains unchanged
+func containsMove(moves []interface{}, move interface{}) bool {
+	for _, m := range moves {
+		if sameMove(m, move) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameMove reports whether a and b are the same move. Moves of comparable
+// types are compared with ==, and others, such as slices, with
+// reflect.DeepEqual, so moves may be of any type.
+func sameMove(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if t := reflect.TypeOf(a); t != reflect.TypeOf(b) || !t.Comparable() {
+		return reflect.DeepEqual(a, b)
+	}
+	return a == b
+}
+
+// discount penalizes fitness reached length moves later by the factor
+// config.DiscountFactor^length, dividing it when minimizing and multiplying
+// it when maximizing, which assumes non-negative fitness
+func discount(fitness float64, length int, config *Config) float64 {
+	factor := math.Pow(config.DiscountFactor, float64(length))
+	if config.Maximize {
+		return fitness * factor
+	}
+	return fitness / factor
+}
+
+// weightedFitness combines several objectives into a single fitness function
+func weightedFitness(components []FitnessFunc, weights []float64) FitnessFunc {
+	return func(sequence []interface{}) float64 {
+		total := 0.0
+		for i, component := range components {
+			total += weights[i] * component(sequence)
+		}
+		return total
+	}
+}
+
+// searchFitness returns the fitness function a search evaluates single
+// sequences with: config.FitnessResultFunc when it is set, the weighted sum of config.FitnessComponents when they
+// are set, or config.BatchFitness one sequence at a time when fitnessFunc
+// is nil
+func searchFitness(fitnessFunc FitnessFunc, config Config) FitnessFunc {
+	if config.FitnessResultFunc != nil {
+		return resultFitness(config.FitnessResultFunc, config.Maximize)
+	}
+	if len(config.FitnessComponents) > 0 {
+		return weightedFitness(config.FitnessComponents, config.FitnessWeights)
+	}
+	if fitnessFunc == nil && config.BatchFitness != nil {
+		return singleFitness(config.BatchFitness, config.Maximize)
+	}
+	return fitnessFunc
+}
+
+// searchMoves wraps nextElements with config.ActionMaskFunc and
+// config.FilterFunc, so the search only sees the moves they allow
+func searchMoves(nextElements NextElementsFunc, config Config) NextElementsFunc {
+	if config.ActionMaskFunc != nil {
+		nextElements = maskedNextElements(nextElements, config.ActionMaskFunc)
+	}
+	if config.FilterFunc != nil {
+		nextElements = filteredNextElements(nextElements, config.FilterFunc)
+	}
+	return nextElements
+}
+
+// maskedNextElements drops every move that mask rejects at the depth it
+// would be played at, so both expansion and rollouts only see allowed moves
+func maskedNextElements(nextElements NextElementsFunc, mask func(depth int, move interface{}) bool) NextElementsFunc {
+	return func(sequence []interface{}) []interface{} {
+		moves := nextElements(sequence)
+		allowed := make([]interface{}, 0, len(moves))
+		for _, move := range moves {
+			if mask(len(sequence), move) {
+				allowed = append(allowed, move)
+			}
+		}
+		return allowed
+	}
+}
+
+// filteredNextElements keeps the moves filter returns, so both expansion
+// and rollouts only see the moves left after pruning
+func filteredNextElements(nextElements NextElementsFunc, filter FilterFunc) NextElementsFunc {
+	return func(sequence []interface{}) []interface{} {
+		moves := nextElements(sequence)
+		if len(moves) == 0 {
+			return moves
+		}
+		return filter(sequence, moves)
+	}
+}
+
+// rankFitness inserts fitness into the sorted observed values and returns
+// the updated slice along with the rank of fitness scaled to [0,1)
+func rankFitness(observed []float64, fitness float64) ([]float64, float64) {
+	r := sort.SearchFloat64s(observed, fitness)
+	observed = append(observed, 0)
+	copy(observed[r+1:], observed[r:])
+	observed[r] = fitness
+	return observed, float64(r) / float64(len(observed))
+}
+
+// scoreChild scores a child for selection under config.Policy, lower is
+// better. Must be called with child.mu held.
+func scoreChild(child *Node, explorationConstant float64, config *Config) float64 {
+	if usesRAVE(config) {
+		return calculateRAVE(child, explorationConstant, config)
+	}
+	return calculateUCT(child, explorationConstant, config)
+}
+
+// backpropagate adds fitness to node and all of its ancestors
 func backpropagate(node *Node, fitness float64) {
-	for node != nil {
-		node.mu.Lock()
-		node.visits++
-		node.totalFitness += fitness
-		node.mu.Unlock()
-		node = node.parent
+	for ; node != nil; node = node.parent {
+		node.addFitness(fitness)
+	}
+}
+
+// backpropagateDiscounted behaves like backpropagate for the rollout
+// sequence, crediting every node with the fitness discounted by
+// config.DiscountFactor once per move between the node and the end of
+// sequence, so nodes closer to the outcome keep more of it
+func backpropagateDiscounted(node *Node, fitness float64, sequence []interface{}, config *Config) {
+	for ; node != nil; node = node.parent {
+		node.addFitness(discount(fitness, len(sequence)-len(node.sequence), config))
+	}
+}
+
+// addFitness records a visit of the node with fitness
+func (node *Node) addFitness(fitness float64) {
+	node.mu.Lock()
+	node.visits++
+	if node.visits == 1 || fitness < node.minFitness {
+		node.minFitness = fitness
+	}
+	if node.visits == 1 || fitness > node.maxFitness {
+		node.maxFitness = fitness
+	}
+	node.lastFitness = fitness
+	node.totalFitness += fitness
+	node.sumSquaredFitness += fitness * fitness
+	node.mu.Unlock()
+}
+
+// inFlight records the nodes an iteration applied virtual loss to, so it
+// is cleared from the same nodes when the iteration ends even if
+// transpositions moved their parent pointers meanwhile. A nil *inFlight
+// applies no virtual loss.
+type inFlight struct {
+	nodes []*Node
+}
+
+// add applies virtual loss to node
+func (path *inFlight) add(node *Node) {
+	if path == nil {
+		return
+	}
+	atomic.AddInt32(&node.virtualLoss, 1)
+	path.nodes = append(path.nodes, node)
+}
+
+// release clears the virtual loss applied to every node of path
+func (path *inFlight) release() {
+	if path == nil {
+		return
 	}
+	for _, node := range path.nodes {
+		atomic.AddInt32(&node.virtualLoss, -1)
+	}
+	path.nodes = nil
 }
 
-// buildSequence updated to use the new termination logic
-func buildSequence(initial []interface{}, nextElements NextElementsFunc, config Config) []interface{} {
+// parallelBuildSequence greedily extends the initial sequence, evaluating
+// every candidate move at each depth on up to config.Parallelism
+// goroutines, so fitnessFunc is only called concurrently when the search
+// itself would, and keeping the best one
+func parallelBuildSequence(
+	initial []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) []interface{} {
 	sequence := make([]interface{}, len(initial))
 	copy(sequence, initial)
 
+	numWorkers := config.Parallelism
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
 	for !isSequenceComplete(sequence, config) {
 		moves := nextElements(sequence)
 		if len(moves) == 0 {
 			break
 		}
-		sequence = append(sequence, moves[0])
+
+		fitness := make([]float64, len(moves))
+		indexChan := make(chan int, len(moves))
+		for i := range moves {
+			indexChan <- i
+		}
+		close(indexChan)
+
+		var wg sync.WaitGroup
+		for w := 0; w < numWorkers && w < len(moves); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexChan {
+					candidate := make([]interface{}, len(sequence)+1)
+					copy(candidate, sequence)
+					candidate[len(sequence)] = moves[i]
+					fitness[i] = fitnessFunc(candidate)
+				}
+			}()
+		}
+		wg.Wait()
+
+		// Ties keep the earliest move so the result stays deterministic
+		best := 0
+		for i := 1; i < len(moves); i++ {
+			if isBetter(config.Maximize, fitness[i], fitness[best]) {
+				best = i
+			}
+		}
+		sequence = append(sequence, moves[best])
 	}
 
 	return sequence
 }
 
 // Helper functions remain unchanged...
+
+// getTreeDepth returns the length of the longest path below node. Nodes
+// shared by transpositions are measured once, which is enough since they
+// are only shared at equal depths.
 func getTreeDepth(node *Node) int {
-	if len(node.children) == 0 {
-		return 0
+	return treeDepth(node, make(map[*Node]int))
+}
+
+func treeDepth(node *Node, depths map[*Node]int) int {
+	if depth, ok := depths[node]; ok {
+		return depth
 	}
-	maxDepth := 0
-	for _, child := range node.children {
-		depth := getTreeDepth(child)
-		if depth > maxDepth {
+	maxDepth := -1
+	for _, child := range node.childrenSnapshot() {
+		if depth := treeDepth(child, depths); depth > maxDepth {
 			maxDepth = depth
 		}
 	}
+	depths[node] = maxDepth + 1
 	return maxDepth + 1
 }
 
+// countNodes returns the number of distinct nodes from node down, counting
+// the nodes shared by transpositions once
 func countNodes(node *Node) int {
-	count := 1
+	seen := make(map[*Node]bool)
+	stack := []*Node{node}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[node] {
+			continue
+		}
+		seen[node] = true
+		stack = append(stack, node.childrenSnapshot()...)
+	}
+	return len(seen)
+}
+
+// childrenSnapshot copies the children of node under its lock, so the
+// tree can be traversed while workers keep expanding it
+func (node *Node) childrenSnapshot() []*Node {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	children := make([]*Node, len(node.children))
+	copy(children, node.children)
+	return children
+}
+
+// Walk visits node and all of its descendants in depth-first order. A node
+// shared by transpositions is visited once, below the first parent reached.
+func Walk(node *Node, fn func(node *Node)) {
+	walk(node, fn, make(map[*Node]bool))
+}
+
+func walk(node *Node, fn func(node *Node), seen map[*Node]bool) {
+	if node == nil || seen[node] {
+		return
+	}
+	seen[node] = true
+	fn(node)
+	for _, child := range node.children {
+		walk(child, fn, seen)
+	}
+}
+
+// HottestNode returns the node with the highest visit count below root,
+// or nil if root has no children
+func HottestNode(root *Node) *Node {
+	var hottest *Node
+	Walk(root, func(node *Node) {
+		if node == root {
+			return
+		}
+		if hottest == nil || node.visits > hottest.visits {
+			hottest = node
+		}
+	})
+	return hottest
+}
+
+// MultiPV returns up to n principal variations, one for each of the
+// children of root preferred by config.FinalSelectionCriteria, most visits
+// by default, each followed down by the same criterion. Like
+// PrincipalVariation, every line holds the moves below root.
+func MultiPV(root *Node, n int, config Config) [][]interface{} {
+	if n <= 0 {
+		return nil
+	}
+	children := rankChildren(root, config.FinalSelectionCriteria, &config)
+	if n > len(children) {
+		n = len(children)
+	}
+
+	lines := make([][]interface{}, 0, n)
+	for _, child := range children[:n] {
+		var line []interface{}
+		for node := child; node != nil; node = selectBestChild(node, config.FinalSelectionCriteria, &config) {
+			line = append(line, node.sequence[len(node.sequence)-1])
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// PrincipalVariation returns the moves from root down to a leaf, always
+// following the most visited child. Unlike the best rollout of a search,
+// which can be a lucky outlier, it is the line the tree currently believes
+// in.
+func PrincipalVariation(root *Node) []interface{} {
+	var moves []interface{}
+	for node := root; len(node.children) > 0; {
+		node = mostVisitedChild(node)
+		moves = append(moves, node.sequence[len(node.sequence)-1])
+	}
+	return moves
+}
+
+func mostVisitedChild(node *Node) *Node {
+	var best *Node
 	for _, child := range node.children {
-		count += countNodes(child)
+		if best == nil || child.visits > best.visits {
+			best = child
+		}
 	}
-	return count
+	return best
+}
+
+// TreeBalance returns the normalized entropy of the visit distribution over
+// the children of root: 0 when all visits went to a single child, 1 when
+// they are spread uniformly
+func TreeBalance(root *Node) float64 {
+	total := 0
+	for _, child := range root.children {
+		total += child.visits
+	}
+	if len(root.children) < 2 || total == 0 {
+		return 0
+	}
+
+	entropy := 0.0
+	for _, child := range root.children {
+		if child.visits == 0 {
+			continue
+		}
+		p := float64(child.visits) / float64(total)
+		entropy -= p * math.Log(p)
+	}
+	return entropy / math.Log(float64(len(root.children)))
+}
+
+// BestMoveVariance returns the variance of the fitness values backpropagated
+// through the most visited child of root, a measure of how certain the
+// outcome of the chosen move is. It is 0 when root has no visited children.
+func BestMoveVariance(root *Node) float64 {
+	best := mostVisitedChild(root)
+	if best == nil || best.visits == 0 {
+		return 0
+	}
+
+	mean := best.totalFitness / float64(best.visits)
+	variance := best.sumSquaredFitness/float64(best.visits) - mean*mean
+	return math.Max(variance, 0) // Guard against rounding below zero
 }
 
 type ProgressStats struct {
@@ -258,20 +1690,26 @@ type ProgressStats struct {
 	TreeDepth    int
 	TotalNodes   int
 	Time         time.Duration
+	CacheHitRate float64 // Share of fitness evaluations answered from the cache, only with EnableMemoization
 }
 
+// printProgress reports stats through config.Logger, stdout by default
 func printProgress(stats ProgressStats, config Config) {
-	fmt.Printf("\n=== Progress Report (Iteration %d) ===\n", stats.Iterations)
-	fmt.Printf("Best Fitness: %f\n", stats.BestFitness)
-	fmt.Printf("Time Elapsed: %v\n", stats.Time)
+	logger := config.logger()
+	logger.Printf("\n=== Progress Report (Iteration %d) ===\n", stats.Iterations)
+	logger.Printf("Best Fitness: %f\n", stats.BestFitness)
+	logger.Printf("Time Elapsed: %v\n", stats.Time)
 
 	if config.DebugLevel > 1 {
-		fmt.Printf("Tree Depth: %d\n", stats.TreeDepth)
-		fmt.Printf("Total Nodes: %d\n", stats.TotalNodes)
+		logger.Printf("Tree Depth: %d\n", stats.TreeDepth)
+		logger.Printf("Total Nodes: %d\n", stats.TotalNodes)
+		if config.EnableMemoization {
+			logger.Printf("Cache Hit Rate: %.1f%%\n", stats.CacheHitRate*100)
+		}
 		if config.SequenceToString != nil {
-			fmt.Printf("Best Sequence: %s\n", config.SequenceToString(stats.BestSequence))
+			logger.Printf("Best Sequence: %s\n", config.SequenceToString(stats.BestSequence))
 		} else {
-			fmt.Printf("Best Sequence: %v\n", stats.BestSequence)
+			logger.Printf("Best Sequence: %v\n", stats.BestSequence)
 		}
 	}
 }
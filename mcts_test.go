@@ -1,9 +1,11 @@
 package mcts
 
 import (
+	"context"
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -239,3 +241,137 @@ func TestMCTSRobust(t *testing.T) {
 		})
 	}
 }
+
+func TestRunPartitionedDeterministic(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       2000,
+		TargetSeqLength:     4,
+		RandomSeed:          42,
+	}
+
+	first, err := RunPartitioned([]interface{}{}, problem.nextElements, problem.fitness, config, 4)
+	if err != nil {
+		t.Fatalf("Partitioned MCTS failed: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		again, err := RunPartitioned([]interface{}{}, problem.nextElements, problem.fitness, config, 4)
+		if err != nil {
+			t.Fatalf("Partitioned MCTS failed: %v", err)
+		}
+		if fmt.Sprint(again) != fmt.Sprint(first) {
+			t.Fatalf("Run %d returned %v, expected %v for the same seed", i, again, first)
+		}
+	}
+
+	reference, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	t.Logf("Partitioned: %v (fitness %f), single-threaded: %v (fitness %f)",
+		first, problem.fitness(first), reference, problem.fitness(reference))
+
+	if len(first) != config.TargetSeqLength {
+		t.Errorf("Expected sequence length %d, got %v", config.TargetSeqLength, first)
+	}
+	// Allow the partitioned search to be off by at most 4 from the
+	// single-threaded one, i.e. a squared error of 16
+	if problem.fitness(first) > problem.fitness(reference)+16 {
+		t.Errorf("Partitioned fitness %f much worse than single-threaded fitness %f",
+			problem.fitness(first), problem.fitness(reference))
+	}
+}
+
+func TestSameSeedConcurrentRunsMatch(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       2000,
+		TargetSeqLength:     4,
+		RandomSeed:          7,
+	}
+
+	const numRuns = 8
+	results := make([][]interface{}, numRuns)
+
+	var wg sync.WaitGroup
+	for i := 0; i < numRuns; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 1; i < numRuns; i++ {
+		if fmt.Sprint(results[i]) != fmt.Sprint(results[0]) {
+			t.Errorf("Run %d returned %v, expected %v for the same seed", i, results[i], results[0])
+		}
+	}
+}
+
+func TestParallelismVirtualLoss(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     30,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     8,
+	}
+
+	var evaluations int64
+	fitness := func(seq []interface{}) float64 {
+		atomic.AddInt64(&evaluations, 1)
+		return problem.fitness(seq)
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       2000,
+		TargetSeqLength:     problem.maxLength,
+		RandomSeed:          time.Now().UnixNano(),
+		Parallelism:         8,
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	if result.Iterations != config.MaxIterations {
+		t.Errorf("Expected %d iterations, got %d", config.MaxIterations, result.Iterations)
+	}
+	if len(result.BestSequence) != config.TargetSeqLength {
+		t.Errorf("Expected sequence length %d, got %v", config.TargetSeqLength, result.BestSequence)
+	}
+
+	// Every simulation is backpropagated to the root exactly once
+	if int64(root.visits) != atomic.LoadInt64(&evaluations) {
+		t.Errorf("Root has %d visits, expected one per simulation (%d)", root.visits, evaluations)
+	}
+
+	Walk(root, func(node *Node) {
+		if vl := atomic.LoadInt32(&node.virtualLoss); vl != 0 {
+			t.Errorf("Node %v still carries virtual loss %d", node.sequence, vl)
+		}
+		childVisits := 0
+		for _, child := range node.children {
+			childVisits += child.visits
+		}
+		if childVisits > node.visits {
+			t.Errorf("Node %v has %d visits but its children have %d", node.sequence, node.visits, childVisits)
+		}
+	})
+}
@@ -1,7 +1,16 @@
 package mcts
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -382,3 +391,4610 @@ func sequenceSum(seq []interface{}) int {
 	}
 	return sum
 }
+
+func TestParallelBuildSequenceFallback(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     9,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     3,
+	}
+
+	// Score partial sequences so the greedy fallback has something to rank,
+	// recording how many calls overlap
+	var running, overlapping int32
+	fitness := func(seq []interface{}) float64 {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.StoreInt32(&overlapping, 1)
+		}
+		defer atomic.AddInt32(&running, -1)
+		time.Sleep(time.Millisecond)
+		return math.Abs(float64(sequenceSum(seq) - problem.targetSum))
+	}
+
+	config := Config{
+		TargetSeqLength: 3,
+	}
+
+	bestSeq := parallelBuildSequence([]interface{}{}, problem.nextElements, fitness, config)
+	if overlapping != 0 {
+		t.Error("Expected a single-threaded config to call the fitness function one sequence at a time")
+	}
+
+	expected := []interface{}{5, 4, 1}
+	if len(bestSeq) != len(expected) {
+		t.Fatalf("Expected fallback sequence %v, got %v", expected, bestSeq)
+	}
+	for i := range expected {
+		if bestSeq[i] != expected[i] {
+			t.Fatalf("Expected fallback sequence %v, got %v", expected, bestSeq)
+		}
+	}
+}
+
+func TestSequenceToGraph(t *testing.T) {
+	sequences := [][]interface{}{
+		{1, 2, 3},
+		{1, 2, 4},
+		{5},
+	}
+
+	dag := SequenceToGraph(sequences, nil)
+
+	// root, 1, 2, 3, 4, 5
+	if len(dag.Nodes) != 6 {
+		t.Fatalf("Expected 6 nodes after merging shared prefixes, got %d", len(dag.Nodes))
+	}
+	if dag.Root.Count != len(sequences) {
+		t.Errorf("Expected root count %d, got %d", len(sequences), dag.Root.Count)
+	}
+
+	shared := dag.Root.Children[0].Children[0]
+	if shared.Move != 2 || shared.Count != 2 {
+		t.Errorf("Expected shared prefix node for move 2 with count 2, got move %v count %d", shared.Move, shared.Count)
+	}
+
+	dag.MoveToString = func(move interface{}) string { return fmt.Sprintf("m%v", move) }
+	dot := dag.ToDOT()
+	if !strings.Contains(dot, `n1 -> n2 [label="m2"]`) {
+		t.Errorf("Expected DOT output to contain labeled shared edge, got:\n%s", dot)
+	}
+}
+
+// sumBound is an admissible bound for TestProblem: the smallest squared
+// error reachable by filling the remaining slots with allowed digits
+func (p *TestProblem) sumBound(seq []interface{}) float64 {
+	remaining := p.maxLength - len(seq)
+	minSum := sequenceSum(seq) + remaining*p.allowedDigits[0]
+	maxSum := sequenceSum(seq) + remaining*p.allowedDigits[len(p.allowedDigits)-1]
+
+	switch {
+	case p.targetSum < minSum:
+		return math.Pow(float64(minSum-p.targetSum), 2)
+	case p.targetSum > maxSum:
+		return math.Pow(float64(p.targetSum-maxSum), 2)
+	}
+	return 0
+}
+
+func TestFitnessBoundPruning(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       2000,
+		TargetSeqLength:     4,
+		RandomSeed:          time.Now().UnixNano(),
+		FitnessBound:        problem.sumBound,
+	}
+
+	t.Run("Pruned moves are never expanded", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(config.RandomSeed))
+
+		// Only 4 completes 5+5+1 to the target, so once a squared error of
+		// 1 is known every other move must be discarded
+		node := &Node{sequence: []interface{}{5, 5, 1}}
+		for i := 0; i < 20; i++ {
+			child := expansion(node, problem.nextElements, config, 1, rng, nil)
+			if child == nil {
+				continue
+			}
+			if move := child.sequence[3]; move != 4 {
+				t.Fatalf("Expanded pruned move %v", move)
+			}
+		}
+
+		// 1+1+1 can never reach 15, so nothing below it is worth expanding
+		hopeless := &Node{sequence: []interface{}{1, 1, 1}}
+		if child := expansion(hopeless, problem.nextElements, config, 10, rng, nil); child != nil {
+			t.Errorf("Expected hopeless node to be pruned, expanded %v", child.sequence)
+		}
+	})
+
+	t.Run("Pruned children are never selected", func(t *testing.T) {
+		root := &Node{visits: 10}
+		good := &Node{sequence: []interface{}{5}, parent: root, visits: 5, totalFitness: 50}
+		bad := &Node{sequence: []interface{}{1, 1, 1}, parent: root, visits: 5, totalFitness: 0}
+		root.children = []*Node{good, bad}
+
+		if selected := selection(root, config.ExplorationConstant, config, 10, nil, nil); selected != good {
+			t.Errorf("Expected selection to skip the pruned child, got %v", selected.sequence)
+		}
+	})
+
+	t.Run("Optimum is still found", func(t *testing.T) {
+		bestSeq, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+		if sum := sequenceSum(bestSeq); len(bestSeq) != problem.maxLength || sum != problem.targetSum {
+			t.Errorf("Expected a sequence of length %d summing to %d, got %v (sum %d)",
+				problem.maxLength, problem.targetSum, bestSeq, sum)
+		}
+	})
+}
+
+func TestRunContextCancellation(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       math.MaxInt32,
+		TargetSeqLength:     4,
+		RandomSeed:          time.Now().UnixNano(),
+	}
+
+	t.Run("Normal completion", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		limited := config
+		limited.MaxIterations = 100
+
+		bestSeq, err := RunContext(ctx, []interface{}{}, problem.nextElements, problem.fitness, limited)
+		if err != nil {
+			t.Errorf("Expected nil error on normal completion, got %v", err)
+		}
+		if len(bestSeq) != limited.TargetSeqLength {
+			t.Errorf("Expected a sequence of length %d, got %v", limited.TargetSeqLength, bestSeq)
+		}
+	})
+
+	t.Run("Cancelled before start", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		bestSeq, err := RunContext(ctx, []interface{}{}, problem.nextElements, problem.fitness, config)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+		if len(bestSeq) != config.TargetSeqLength {
+			t.Errorf("Expected a fallback sequence of length %d, got %v", config.TargetSeqLength, bestSeq)
+		}
+	})
+
+	t.Run("Deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		bestSeq, err := RunContext(ctx, []interface{}{}, problem.nextElements, problem.fitness, config)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("Search did not stop at the deadline, took %v", elapsed)
+		}
+		if bestSeq == nil {
+			t.Error("Expected the best sequence found so far, got nil")
+		}
+	})
+}
+
+func TestMaxDuration(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	for _, maxIterations := range []int{0, math.MaxInt32} {
+		t.Run(fmt.Sprintf("MaxIterations=%d", maxIterations), func(t *testing.T) {
+			config := Config{
+				ExplorationConstant: 2.0,
+				MaxIterations:       maxIterations,
+				MaxDuration:         50 * time.Millisecond,
+				TargetSeqLength:     4,
+				RandomSeed:          time.Now().UnixNano(),
+			}
+
+			start := time.Now()
+			bestSeq, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+			elapsed := time.Since(start)
+
+			if err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			if elapsed < config.MaxDuration || elapsed > config.MaxDuration+250*time.Millisecond {
+				t.Errorf("Expected search to stop close to %v, took %v", config.MaxDuration, elapsed)
+			}
+			if len(bestSeq) != config.TargetSeqLength {
+				t.Errorf("Expected sequence length %d, got %v", config.TargetSeqLength, bestSeq)
+			}
+		})
+	}
+
+	t.Run("No budget", func(t *testing.T) {
+		config := Config{TargetSeqLength: 4}
+		if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err == nil {
+			t.Error("Expected an error when neither MaxIterations nor MaxDuration is set")
+		}
+	})
+}
+
+func TestFitnessRankTransform(t *testing.T) {
+	observed, rank := rankFitness(nil, 5)
+	if rank != 0 {
+		t.Errorf("Expected rank 0 for the first observation, got %f", rank)
+	}
+	observed, rank = rankFitness(observed, 1)
+	if rank != 0 {
+		t.Errorf("Expected rank 0 for a new minimum, got %f", rank)
+	}
+	observed, rank = rankFitness(observed, math.MaxFloat64)
+	if rank != 2.0/3.0 {
+		t.Errorf("Expected rank 2/3 for the worst of three, got %f", rank)
+	}
+	if len(observed) != 3 || observed[0] != 1 || observed[1] != 5 {
+		t.Errorf("Expected observed values to stay sorted, got %v", observed)
+	}
+
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant:  2.0,
+		MaxIterations:        2000,
+		TargetSeqLength:      4,
+		RandomSeed:           time.Now().UnixNano(),
+		FitnessRankTransform: true,
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if len(result.BestSequence) != config.TargetSeqLength {
+		t.Errorf("Expected sequence length %d, got %v", config.TargetSeqLength, result.BestSequence)
+	}
+
+	Walk(root, func(node *Node) {
+		if node.visits == 0 {
+			return
+		}
+		if mean := node.totalFitness / float64(node.visits); mean < 0 || mean > 1 {
+			t.Errorf("Expected normalized mean fitness in [0,1], got %f for %v", mean, node.sequence)
+		}
+	})
+}
+
+// DeceptiveProblem rewards zeros everywhere except for the all-ones
+// sequence, which is the global optimum
+type DeceptiveProblem struct {
+	length int
+}
+
+func (p *DeceptiveProblem) nextElements(seq []interface{}) []interface{} {
+	if len(seq) >= p.length {
+		return nil
+	}
+	return []interface{}{0, 1}
+}
+
+func (p *DeceptiveProblem) fitness(seq []interface{}) float64 {
+	ones := sequenceSum(seq)
+	if ones == p.length {
+		return -float64(10 * p.length)
+	}
+	return -float64(p.length - ones)
+}
+
+func TestSearcherRestarts(t *testing.T) {
+	problem := &DeceptiveProblem{length: 6}
+
+	const (
+		restarts    = 10
+		totalBudget = 600
+		numSeeds    = 20
+	)
+
+	singleTotal, restartTotal := 0.0, 0.0
+	for seed := int64(0); seed < numSeeds; seed++ {
+		config := Config{
+			MaxIterations:   totalBudget,
+			TargetSeqLength: problem.length,
+			RandomSeed:      seed,
+		}
+
+		single, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+
+		config.MaxIterations = totalBudget / restarts
+		searcher := NewSearcher(problem.nextElements, problem.fitness, config)
+
+		var best []interface{}
+		for i := 0; i < restarts; i++ {
+			if best, err = searcher.Run([]interface{}{}); err != nil {
+				t.Fatalf("Restart %d failed with error: %v", i, err)
+			}
+		}
+
+		if searcher.RestartCount != restarts {
+			t.Errorf("Expected %d restarts, got %d", restarts, searcher.RestartCount)
+		}
+		if problem.fitness(best) > problem.fitness(single) {
+			t.Errorf("Seed %d: restarts found %v, worse than the single run's %v", seed, best, single)
+		}
+
+		singleTotal += problem.fitness(single)
+		restartTotal += problem.fitness(best)
+	}
+
+	t.Logf("Average fitness: single run %.2f, %d restarts %.2f",
+		singleTotal/numSeeds, restarts, restartTotal/numSeeds)
+
+	if restartTotal >= singleTotal {
+		t.Errorf("Expected restarts to beat a single run of equal budget (%.2f vs %.2f)",
+			restartTotal/numSeeds, singleTotal/numSeeds)
+	}
+}
+
+func TestSearcherRestartState(t *testing.T) {
+	problem := &TestProblem{targetSum: 15, allowedDigits: []int{1, 2, 3, 4, 5}, maxLength: 4}
+
+	t.Run("Returned sequence is a copy", func(t *testing.T) {
+		searcher := NewSearcher(problem.nextElements, problem.fitness, Config{MaxIterations: 50, TargetSeqLength: 4})
+		best, err := searcher.Run([]interface{}{})
+		if err != nil {
+			t.Fatalf("Search failed with error: %v", err)
+		}
+		kept := fmt.Sprint(searcher.bestSequence)
+		best[0] = "corrupted"
+		if got := fmt.Sprint(searcher.bestSequence); got != kept {
+			t.Errorf("Expected the kept best sequence %s untouched by the caller, got %s", kept, got)
+		}
+	})
+
+	t.Run("Restarts reseed Rand", func(t *testing.T) {
+		// Two searchers differing only in Rand must search alike once reseeded
+		restart := func(source int64) string {
+			var evaluated []string
+			fitness := func(sequence []interface{}) float64 {
+				evaluated = append(evaluated, fmt.Sprint(sequence))
+				return problem.fitness(sequence)
+			}
+			config := Config{MaxIterations: 50, TargetSeqLength: 4, RandomSeed: 5, Rand: rand.New(rand.NewSource(source))}
+			searcher := NewSearcher(problem.nextElements, fitness, config)
+			if _, err := searcher.Run([]interface{}{}); err != nil {
+				t.Fatalf("Search failed with error: %v", err)
+			}
+			evaluated = nil
+			if _, err := searcher.Run([]interface{}{}); err != nil {
+				t.Fatalf("Restart failed with error: %v", err)
+			}
+			return strings.Join(evaluated, " ")
+		}
+		if first, second := restart(1), restart(99); first != second {
+			t.Errorf("Expected restarts seeded from RandomSeed alike, got:\n%s\nand:\n%s", first, second)
+		}
+	})
+}
+
+func TestInteractiveMode(t *testing.T) {
+	defer func(input io.Reader, output io.Writer) {
+		interactiveInput, interactiveOutput = input, output
+	}(interactiveInput, interactiveOutput)
+
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		MaxIterations:       1000,
+		TargetSeqLength:     4,
+		RandomSeed:          time.Now().UnixNano(),
+		InteractiveMode:     true,
+		InteractiveInterval: 10,
+	}
+
+	t.Run("Inject move then quit", func(t *testing.T) {
+		var output strings.Builder
+		interactiveInput = strings.NewReader("7\n3\nquit\n")
+		interactiveOutput = &output
+
+		root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+		bestSeq := result.BestSequence
+
+		if prompts := strings.Count(output.String(), "> "); prompts != 3 {
+			t.Errorf("Expected 3 pauses before quitting, got %d", prompts)
+		}
+		if !strings.Contains(output.String(), `invalid move "7"`) {
+			t.Errorf("Expected move 7 to be rejected, got:\n%s", output.String())
+		}
+
+		injected := false
+		for _, child := range root.children {
+			if child.sequence[0] == 3 {
+				injected = true
+			}
+		}
+		if !injected {
+			t.Error("Expected move 3 to be expanded at the root")
+		}
+		if len(bestSeq) != config.TargetSeqLength {
+			t.Errorf("Expected sequence length %d, got %v", config.TargetSeqLength, bestSeq)
+		}
+	})
+
+	t.Run("Injected moves are initialized like expansions", func(t *testing.T) {
+		interactiveInput = strings.NewReader("3\nquit\n")
+		interactiveOutput = io.Discard
+
+		var mu sync.Mutex
+		initialized := map[*Node]bool{}
+		puct := config
+		puct.InteractiveInterval = 1
+		puct.UCTVariant = UCTVariantPUCT
+		puct.PriorFunc = func(sequence []interface{}, moves []interface{}) []float64 {
+			priors := make([]float64, len(moves))
+			for i, move := range moves {
+				priors[i] = float64(move.(int)) / 15
+			}
+			return priors
+		}
+		puct.NodeInit = func(node *Node, sequence []interface{}) {
+			mu.Lock()
+			initialized[node] = true
+			mu.Unlock()
+		}
+
+		root, _, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, puct)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+
+		for _, child := range root.children {
+			if child.sequence[0] != 3 {
+				continue
+			}
+			if child.prior != 0.2 {
+				t.Errorf("Expected the injected move to get prior 0.2, got %f", child.prior)
+			}
+			if !initialized[child] {
+				t.Error("Expected NodeInit to be called on the injected move")
+			}
+			return
+		}
+		t.Error("Expected move 3 to be expanded at the root")
+	})
+
+	t.Run("Auto resumes without pauses", func(t *testing.T) {
+		var output strings.Builder
+		interactiveInput = strings.NewReader("auto\n")
+		interactiveOutput = &output
+
+		if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+		if prompts := strings.Count(output.String(), "> "); prompts != 1 {
+			t.Errorf("Expected a single pause before resuming, got %d", prompts)
+		}
+	})
+}
+
+func TestRunDetailed(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       500,
+		TargetSeqLength:     4,
+		RandomSeed:          time.Now().UnixNano(),
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if fitness := problem.fitness(result.BestSequence); result.BestFitness != fitness {
+		t.Errorf("Expected best fitness %f for %v, got %f", fitness, result.BestSequence, result.BestFitness)
+	}
+	if result.Iterations != config.MaxIterations {
+		t.Errorf("Expected %d iterations, got %d", config.MaxIterations, result.Iterations)
+	}
+	if result.Elapsed <= 0 {
+		t.Errorf("Expected a positive elapsed time, got %v", result.Elapsed)
+	}
+	if result.TreeDepth != getTreeDepth(root) || result.TreeDepth == 0 {
+		t.Errorf("Expected tree depth %d, got %d", getTreeDepth(root), result.TreeDepth)
+	}
+	if result.TotalNodes != countNodes(root) || result.TotalNodes <= 1 {
+		t.Errorf("Expected %d nodes, got %d", countNodes(root), result.TotalNodes)
+	}
+}
+
+// bufferLogger collects log output for assertions
+type bufferLogger struct {
+	strings.Builder
+}
+
+func (l *bufferLogger) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(&l.Builder, format, args...)
+}
+
+func TestTracedIteration(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	logger := &bufferLogger{}
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       100,
+		TargetSeqLength:     4,
+		RandomSeed:          time.Now().UnixNano(),
+		TracedIteration:     10,
+		Logger:              logger,
+	}
+
+	if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	output := logger.String()
+	if steps := strings.Count(output, "selection depth=0 "); steps != 1 {
+		t.Fatalf("Expected exactly one traced iteration, got %d:\n%s", steps, output)
+	}
+	if !strings.Contains(output, "explorationBonus=") || !strings.Contains(output, "uct=") {
+		t.Errorf("Expected candidate scores in the trace, got:\n%s", output)
+	}
+	t.Logf("Trace:\n%s", output)
+
+	// The breakdown adds up to the score whatever value selection exploits
+	parent := &Node{visits: 10}
+	child := &Node{sequence: []interface{}{3}, parent: parent, visits: 4, totalFitness: 8, minFitness: 1, maxFitness: 3}
+	best := &Config{BackupStrategy: BackupMax}
+	uct := calculateUCT(child, 2, best)
+	if score := scoreCandidate(child, 2, best, uct); score.AvgFitness != 1 || math.Abs(score.AvgFitness-score.ExplorationBonus-uct) > 1e-9 {
+		t.Errorf("Expected value 1 and the exploration term of %f, got %+v", uct, score)
+	}
+	forced := &Config{MinVisitsBeforeUCT: 5}
+	if score := scoreCandidate(child, 2, forced, calculateUCT(child, 2, forced)); score.AvgFitness != 2 || score.ExplorationBonus != 0 {
+		t.Errorf("Expected value 2 and no exploration term for a forced child, got %+v", score)
+	}
+}
+
+func TestResultRootInspection(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          500,
+		TargetSeqLength:        4,
+		RandomSeed:             time.Now().UnixNano(),
+		GuaranteeFullExpansion: true,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	root := result.Root
+	if root == nil {
+		t.Fatal("Expected the result to expose the root node")
+	}
+	if len(root.Sequence()) != 0 {
+		t.Errorf("Expected an empty root sequence, got %v", root.Sequence())
+	}
+
+	children := root.Children()
+	if len(children) != len(problem.allowedDigits) {
+		t.Fatalf("Expected %d root children, got %d", len(problem.allowedDigits), len(children))
+	}
+
+	visits, total := 0, 0.0
+	for _, child := range children {
+		if len(child.Sequence()) != 1 {
+			t.Errorf("Expected child sequence of length 1, got %v", child.Sequence())
+		}
+		visits += child.Visits()
+		total += child.MeanFitness() * float64(child.Visits())
+	}
+	if visits != root.Visits() {
+		t.Errorf("Expected children visits to add up to root visits %d, got %d", root.Visits(), visits)
+	}
+	if mean := total / float64(visits); math.Abs(mean-root.MeanFitness()) > 1e-6 {
+		t.Errorf("Expected children to average to root mean %f, got %f", root.MeanFitness(), mean)
+	}
+}
+
+func TestRAVEPolicy(t *testing.T) {
+	t.Run("AMAF credits siblings played later", func(t *testing.T) {
+		root := &Node{sequence: []interface{}{}}
+		played := &Node{sequence: []interface{}{1}, parent: root}
+		later := &Node{sequence: []interface{}{3}, parent: root}
+		unplayed := &Node{sequence: []interface{}{5}, parent: root}
+		root.children = []*Node{played, later, unplayed}
+
+		updateAMAF(played, []interface{}{1, 2, 3, 4}, 7)
+
+		if played.amafVisits != 1 || later.amafVisits != 1 {
+			t.Errorf("Expected moves 1 and 3 to get AMAF credit, got %d and %d", played.amafVisits, later.amafVisits)
+		}
+		if later.amafFitness != 7 {
+			t.Errorf("Expected AMAF fitness 7, got %f", later.amafFitness)
+		}
+		if unplayed.amafVisits != 0 {
+			t.Errorf("Expected move 5 to get no AMAF credit, got %d", unplayed.amafVisits)
+		}
+	})
+
+	t.Run("Front", func(t *testing.T) {
+		front := &paretoFront{}
+		add := func(sequence []interface{}, objectives []float64) float64 {
+			gain, err := front.add(sequence, objectives)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			return gain
+		}
+		if gain := add([]interface{}{1}, []float64{2, 2}); gain <= 0 {
+			t.Errorf("Expected the first solution to add hypervolume, got %f", gain)
+		}
+		if gain := add([]interface{}{2}, []float64{3, 3}); gain != 0 {
+			t.Errorf("Expected a dominated solution to add nothing, got %f", gain)
+		}
+		if gain := add([]interface{}{3}, []float64{1, 3}); gain <= 0 {
+			t.Errorf("Expected a trade-off solution to add hypervolume, got %f", gain)
+		}
+		if gain := add([]interface{}{4}, []float64{1, 1}); gain <= 0 {
+			t.Errorf("Expected a dominating solution to add hypervolume, got %f", gain)
+		}
+		if len(front.solutions) != 1 || front.solutions[0].Sequence[0] != 4 {
+			t.Errorf("Expected the dominating solution to replace the front, got %v", front.solutions)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		problem := &TestProblem{
+			targetSum:     15,
+			allowedDigits: []int{1, 2, 3, 4, 5},
+			maxLength:     4,
+		}
+
+		config := Config{
+			ExplorationConstant:    2.0,
+			MaxIterations:          2000,
+			TargetSeqLength:        4,
+			RandomSeed:             time.Now().UnixNano(),
+			GuaranteeFullExpansion: true,
+			Policy:                 PolicyRAVE,
+			RAVEBias:               0.1,
+		}
+
+		root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+
+		Walk(root, func(node *Node) {
+			if node != root && node.visits > 0 && node.amafVisits < node.visits {
+				t.Errorf("Node %v has %d AMAF visits, fewer than its %d visits", node.sequence, node.amafVisits, node.visits)
+			}
+		})
+
+		if fitness := result.BestFitness; fitness > 16 {
+			t.Errorf("Fitness too high: %f for %v", fitness, result.BestSequence)
+		}
+	})
+}
+
+func TestFitnessComponents(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	// Prefer hitting the target sum, and among those prefer fewer fives
+	fives := func(seq []interface{}) float64 {
+		count := 0
+		for _, v := range seq {
+			if v == 5 {
+				count++
+			}
+		}
+		return float64(count)
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          2000,
+		TargetSeqLength:        4,
+		RandomSeed:             time.Now().UnixNano(),
+		GuaranteeFullExpansion: true,
+		FitnessComponents:      []FitnessFunc{problem.fitness, fives},
+		FitnessWeights:         []float64{10, 1},
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, nil, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if len(result.Components) != 2 {
+		t.Fatalf("Expected 2 component values, got %v", result.Components)
+	}
+	if result.Components[0] != problem.fitness(result.BestSequence) || result.Components[1] != fives(result.BestSequence) {
+		t.Errorf("Component values %v do not match best sequence %v", result.Components, result.BestSequence)
+	}
+	if expected := 10*result.Components[0] + result.Components[1]; result.BestFitness != expected {
+		t.Errorf("Expected weighted fitness %f, got %f", expected, result.BestFitness)
+	}
+
+	config.FitnessWeights = []float64{1}
+	if _, err := Run([]interface{}{}, problem.nextElements, nil, config); err == nil {
+		t.Error("Expected an error for mismatched FitnessWeights")
+	}
+}
+
+func TestShrinkTree(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          300,
+		TargetSeqLength:        4,
+		RandomSeed:             time.Now().UnixNano(),
+		GuaranteeFullExpansion: true,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	const maxNodes = 20
+	tree := &Tree{Root: result.Root}
+	shrunk := ShrinkTree(tree, maxNodes)
+
+	if total := countNodes(shrunk.Root); total != maxNodes {
+		t.Fatalf("Expected exactly %d nodes after shrinking %d, got %d", maxNodes, result.TotalNodes, total)
+	}
+	if shrunk.Root.visits != result.Root.visits {
+		t.Errorf("Expected root visits %d to be kept, got %d", result.Root.visits, shrunk.Root.visits)
+	}
+	if countNodes(result.Root) != result.TotalNodes {
+		t.Error("Expected the original tree to be left untouched")
+	}
+
+	// Every dropped child must be available for expansion again, leaves
+	// that were never expanded generate their moves lazily
+	Walk(shrunk.Root, func(node *Node) {
+		moves := len(node.children) + len(node.unusedMoves)
+		if moves > 0 && moves != len(problem.allowedDigits) {
+			t.Errorf("Node %v has %d children and unused moves, expected %d",
+				node.sequence, moves, len(problem.allowedDigits))
+		}
+		for _, child := range node.children {
+			if child.parent != node {
+				t.Errorf("Child %v does not point back to its parent", child.sequence)
+			}
+			if child.visits > node.visits {
+				t.Errorf("Kept child %v has more visits than its parent", child.sequence)
+			}
+		}
+	})
+
+	resumed, err := RunContinue(context.Background(), shrunk, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("Resumed MCTS failed with error: %v", err)
+	}
+	if resumed.Root != shrunk.Root || resumed.TotalNodes <= maxNodes {
+		t.Errorf("Expected the resumed search to grow the shrunk tree, got %d nodes", resumed.TotalNodes)
+	}
+}
+
+func TestTreeJSON(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          300,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	data, err := json.Marshal(&Tree{Root: result.Root})
+	if err != nil {
+		t.Fatalf("Marshal failed with error: %v", err)
+	}
+
+	restored := &Tree{
+		DecodeMove: func(data json.RawMessage) (interface{}, error) {
+			var digit int
+			err := json.Unmarshal(data, &digit)
+			return digit, err
+		},
+	}
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("Unmarshal failed with error: %v", err)
+	}
+
+	var compare func(original, copy *Node)
+	compare = func(original, copy *Node) {
+		if fmt.Sprint(original.sequence) != fmt.Sprint(copy.sequence) {
+			t.Errorf("Expected sequence %v, got %v", original.sequence, copy.sequence)
+		}
+		for i := range original.sequence {
+			if original.sequence[i] != copy.sequence[i] {
+				t.Errorf("Expected move %#v in %v, got %#v", original.sequence[i], original.sequence, copy.sequence[i])
+			}
+		}
+		if original.visits != copy.visits || original.totalFitness != copy.totalFitness ||
+			original.sumSquaredFitness != copy.sumSquaredFitness ||
+			original.minFitness != copy.minFitness || original.maxFitness != copy.maxFitness {
+			t.Errorf("Statistics of %v changed: %d %v %v became %d %v %v", original.sequence,
+				original.visits, original.totalFitness, original.sumSquaredFitness,
+				copy.visits, copy.totalFitness, copy.sumSquaredFitness)
+		}
+		if len(original.unusedMoves) != len(copy.unusedMoves) {
+			t.Errorf("Expected %d unused moves at %v, got %d", len(original.unusedMoves), original.sequence, len(copy.unusedMoves))
+		}
+		if len(original.children) != len(copy.children) {
+			t.Fatalf("Expected %d children at %v, got %d", len(original.children), original.sequence, len(copy.children))
+		}
+		for i, child := range copy.children {
+			if child.parent != copy {
+				t.Errorf("Child %v does not point back to its parent", child.sequence)
+			}
+			compare(original.children[i], child)
+		}
+	}
+	compare(result.Root, restored.Root)
+
+	// Without DecodeMove moves come back as encoding/json decodes them
+	generic := &Tree{}
+	if err := json.Unmarshal(data, generic); err != nil {
+		t.Fatalf("Unmarshal failed with error: %v", err)
+	}
+	if move := generic.Root.children[0].sequence[0]; move != float64(result.Root.children[0].sequence[0].(int)) {
+		t.Errorf("Expected the first move to decode as a float64, got %#v", move)
+	}
+
+	config.ReuseTree = restored.Root
+	resumed, err := RunDetailed(context.Background(), nil, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("Resumed MCTS failed with error: %v", err)
+	}
+	if resumed.Root != restored.Root || resumed.Root.visits < result.Root.visits {
+		t.Errorf("Expected the search to resume from the %d restored visits, got %d", result.Root.visits, resumed.Root.visits)
+	}
+}
+
+func TestMarshalTree(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     23,
+		allowedDigits: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		maxLength:     5,
+	}
+	config := Config{
+		MaxIterations:   10,
+		TargetSeqLength: 5,
+		RandomSeed:      1,
+	}
+
+	checkpoint, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	data, err := MarshalTree(checkpoint.Root)
+	if err != nil {
+		t.Fatalf("MarshalTree failed with error: %v", err)
+	}
+	root, err := UnmarshalTree(data)
+	if err != nil {
+		t.Fatalf("UnmarshalTree failed with error: %v", err)
+	}
+
+	var compare func(original, copy *Node)
+	compare = func(original, copy *Node) {
+		for i := range original.sequence {
+			if original.sequence[i] != copy.sequence[i] {
+				t.Errorf("Expected move %#v in %v, got %#v", original.sequence[i], original.sequence, copy.sequence[i])
+			}
+		}
+		if original.visits != copy.visits || original.totalFitness != copy.totalFitness {
+			t.Errorf("Statistics of %v changed: %d %v became %d %v", original.sequence,
+				original.visits, original.totalFitness, copy.visits, copy.totalFitness)
+		}
+		if len(original.children) != len(copy.children) {
+			t.Fatalf("Expected %d children at %v, got %d", len(original.children), original.sequence, len(copy.children))
+		}
+		for i, child := range copy.children {
+			if child.parent != copy {
+				t.Errorf("Child %v does not point back to its parent", child.sequence)
+			}
+			compare(original.children[i], child)
+		}
+	}
+	compare(checkpoint.Root, root)
+
+	// The fitness asserts int moves, so the resumed search also checks that
+	// moves decode as int without a DecodeMove
+	config.MaxIterations = 500
+	config.ReuseTree = root
+	resumed, err := RunDetailed(context.Background(), nil, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("Resumed MCTS failed with error: %v", err)
+	}
+	t.Logf("Best fitness %v at the checkpoint, %v after resuming", checkpoint.BestFitness, resumed.BestFitness)
+	if resumed.Root.Visits() <= checkpoint.Root.Visits() {
+		t.Errorf("Expected the resumed search to add to the %d checkpoint visits, got %d",
+			checkpoint.Root.Visits(), resumed.Root.Visits())
+	}
+	if resumed.BestFitness >= checkpoint.BestFitness {
+		t.Errorf("Expected the resumed search to improve on fitness %v, got %v", checkpoint.BestFitness, resumed.BestFitness)
+	}
+}
+
+func TestUCTVariants(t *testing.T) {
+	t.Run("UCB1-Tuned shrinks the bound of a low-variance child", func(t *testing.T) {
+		root := &Node{sequence: []interface{}{}, visits: 100}
+		child := &Node{sequence: []interface{}{1}, parent: root, visits: 10, totalFitness: 50, sumSquaredFitness: 250}
+		root.children = []*Node{child}
+
+		ucb1 := explorationBonus(child, root, 1, &Config{UCTVariant: UCTVariantUCB1}, child.visits)
+		tuned := explorationBonus(child, root, 1, &Config{UCTVariant: UCTVariantUCB1Tuned}, child.visits)
+		if tuned >= ucb1 {
+			t.Errorf("Expected UCB1-Tuned bonus below UCB1 for a constant child, got %f >= %f", tuned, ucb1)
+		}
+	})
+
+	t.Run("PUCT takes priors from PriorFunc", func(t *testing.T) {
+		root := &Node{sequence: []interface{}{}}
+		nextElements := func(seq []interface{}) []interface{} { return []interface{}{1, 2, 3} }
+		config := Config{
+			UCTVariant: UCTVariantPUCT,
+			PriorFunc: func(seq []interface{}, moves []interface{}) []float64 {
+				return []float64{0.7, 0.2, 0.1}
+			},
+		}
+
+		if prior := movePrior(root, 2, nextElements, config); prior != 0.2 {
+			t.Errorf("Expected prior 0.2 for move 2, got %f", prior)
+		}
+		config.PriorFunc = nil
+		if prior := movePrior(&Node{sequence: []interface{}{}}, 2, nextElements, config); math.Abs(prior-1.0/3) > 1e-9 {
+			t.Errorf("Expected uniform prior 1/3 without PriorFunc, got %f", prior)
+		}
+	})
+
+	t.Run("PerMovePrior scores each move", func(t *testing.T) {
+		nextElements := func(seq []interface{}) []interface{} { return []interface{}{1, 2, 3} }
+		config := Config{
+			UCTVariant: UCTVariantPUCT,
+			PriorFunc: PerMovePrior(func(seq []interface{}, move interface{}) float64 {
+				return float64(move.(int)) / 6
+			}),
+		}
+
+		for _, move := range []int{1, 2, 3} {
+			prior := movePrior(&Node{sequence: []interface{}{}}, move, nextElements, config)
+			if math.Abs(prior-float64(move)/6) > 1e-9 {
+				t.Errorf("Expected prior %f for move %d, got %f", float64(move)/6, move, prior)
+			}
+		}
+	})
+
+	t.Run("Unknown variant", func(t *testing.T) {
+		problem := &TestProblem{targetSum: 15, allowedDigits: []int{1, 2, 3, 4, 5}, maxLength: 4}
+		config := Config{MaxIterations: 10, TargetSeqLength: 4, UCTVariant: "ucb2"}
+		if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err == nil {
+			t.Error("Expected an error for an unknown UCTVariant")
+		}
+	})
+
+	for _, variant := range []string{UCTVariantUCB1, UCTVariantUCB1Tuned, UCTVariantPUCT} {
+		t.Run("Search "+variant, func(t *testing.T) {
+			problem := &TestProblem{
+				targetSum:     15,
+				allowedDigits: []int{1, 2, 3, 4, 5},
+				maxLength:     4,
+			}
+
+			config := Config{
+				ExplorationConstant:    2.0,
+				MaxIterations:          2000,
+				TargetSeqLength:        4,
+				RandomSeed:             time.Now().UnixNano(),
+				GuaranteeFullExpansion: true,
+				UCTVariant:             variant,
+			}
+
+			result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			if fitness := result.BestFitness; fitness > 16 {
+				t.Errorf("Fitness too high: %f for %v", fitness, result.BestSequence)
+			}
+		})
+	}
+}
+
+func TestLazyRootExpansion(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	rootCalls := 0
+	nextElements := func(seq []interface{}) []interface{} {
+		if len(seq) == 0 {
+			rootCalls++
+		}
+		return problem.nextElements(seq)
+	}
+
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       2000,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+		LazyRootExpansion:   true,
+	}
+
+	root := &Node{sequence: []interface{}{}}
+	initRoot(root, nextElements, config)
+	if rootCalls != 0 || root.unusedMoves != nil {
+		t.Fatalf("Expected no root moves before the first iteration, got %d calls and moves %v", rootCalls, root.unusedMoves)
+	}
+
+	rng := rand.New(rand.NewSource(config.RandomSeed))
+	if child := expansion(root, nextElements, config, math.MaxFloat64, rng, nil); child == nil {
+		t.Fatal("Expected the first expansion to add a child")
+	}
+	if rootCalls != 1 {
+		t.Errorf("Expected the first expansion to compute the root moves once, got %d calls", rootCalls)
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if len(result.BestSequence) != 4 {
+		t.Errorf("Expected a complete sequence, got %v", result.BestSequence)
+	}
+}
+
+func TestUCB1TunedPolicy(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+	// Scale fitness to roughly [0,1], where the UCB1 bound over-explores
+	fitness := func(seq []interface{}) float64 {
+		return problem.fitness(seq) / 121
+	}
+
+	// The mean fitness of all rollouts measures how tightly the search
+	// concentrates on good sequences within the same budget
+	meanRolloutFitness := func(variant string) float64 {
+		total := 0.0
+		for seed := int64(0); seed < 10; seed++ {
+			config := Config{
+				ExplorationConstant:    1.41,
+				MaxIterations:          500,
+				TargetSeqLength:        4,
+				RandomSeed:             seed,
+				GuaranteeFullExpansion: true,
+				UCTVariant:             variant,
+			}
+
+			root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			if result.BestFitness != 0 {
+				t.Errorf("%s seed %d: expected an exact solution, got %v", variant, seed, result.BestSequence)
+			}
+			total += root.MeanFitness()
+		}
+		return total / 10
+	}
+
+	uct := meanRolloutFitness(UCTVariantUCB1)
+	tuned := meanRolloutFitness(UCTVariantUCB1Tuned)
+	t.Logf("Mean rollout fitness: UCT %.4f, UCB1-Tuned %.4f", uct, tuned)
+
+	if tuned >= uct {
+		t.Errorf("Expected UCB1-Tuned to converge tighter than UCT, got mean fitness %.4f >= %.4f", tuned, uct)
+	}
+}
+
+func TestActionMaskFunc(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	// Digit 5 is only allowed in the first two positions
+	mask := func(depth int, move interface{}) bool {
+		return depth < 2 || move != 5
+	}
+	respectsMask := func(seq []interface{}) bool {
+		for depth, move := range seq {
+			if !mask(depth, move) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var violations int32
+	fitness := func(seq []interface{}) float64 {
+		if !respectsMask(seq) {
+			atomic.AddInt32(&violations, 1)
+		}
+		return problem.fitness(seq)
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          2000,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		ActionMaskFunc:         mask,
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if violations > 0 {
+		t.Errorf("Rollouts evaluated %d sequences with masked moves", violations)
+	}
+	Walk(root, func(node *Node) {
+		if !respectsMask(node.sequence) {
+			t.Errorf("Tree contains masked sequence %v", node.sequence)
+		}
+	})
+	if !respectsMask(result.BestSequence) || result.BestFitness != 0 {
+		t.Errorf("Expected an exact solution respecting the mask, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+	}
+}
+
+func TestFilterFunc(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     12,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	// Prune every digit already in the sequence, which a depth-indexed
+	// mask cannot express
+	filter := func(sequence []interface{}, moves []interface{}) []interface{} {
+		var kept []interface{}
+		for _, move := range moves {
+			if !containsMove(sequence, move) {
+				kept = append(kept, move)
+			}
+		}
+		return kept
+	}
+	distinct := func(seq []interface{}) bool {
+		for i := range seq {
+			if containsMove(seq[:i], seq[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	var violations int32
+	fitness := func(seq []interface{}) float64 {
+		if !distinct(seq) {
+			atomic.AddInt32(&violations, 1)
+		}
+		return problem.fitness(seq)
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          2000,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		FilterFunc:             filter,
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if violations > 0 {
+		t.Errorf("Rollouts evaluated %d sequences with filtered moves", violations)
+	}
+	Walk(root, func(node *Node) {
+		if !distinct(node.sequence) {
+			t.Errorf("Tree contains filtered sequence %v", node.sequence)
+		}
+	})
+	if !distinct(result.BestSequence) || result.BestFitness != 0 {
+		t.Errorf("Expected an exact solution of distinct digits, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+	}
+}
+
+func TestProgressiveWidening(t *testing.T) {
+	digits := make([]int, 300)
+	for i := range digits {
+		digits[i] = i
+	}
+	problem := &TestProblem{
+		targetSum:     600,
+		allowedDigits: digits,
+		maxLength:     4,
+	}
+
+	run := func(widening bool) (*Node, *Result) {
+		config := Config{
+			ExplorationConstant:    1.41,
+			MaxIterations:          2000,
+			TargetSeqLength:        4,
+			RandomSeed:             1,
+			GuaranteeFullExpansion: true,
+			ProgressiveWidening:    widening,
+		}
+		root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+		return root, result
+	}
+
+	wideRoot, wide := run(false)
+	root, widened := run(true)
+
+	Walk(root, func(node *Node) {
+		limit := int(math.Max(1, math.Floor(math.Sqrt(float64(node.visits)))))
+		if len(node.children) > limit {
+			t.Errorf("Node %v has %d children for %d visits, want at most %d", node.sequence, len(node.children), node.visits, limit)
+		}
+	})
+
+	if len(root.children) >= len(wideRoot.children) {
+		t.Errorf("Expected widening to narrow the root, got %d children vs %d", len(root.children), len(wideRoot.children))
+	}
+	if widened.TreeDepth <= wide.TreeDepth {
+		t.Errorf("Expected widening to grow a deeper tree, got depth %d vs %d", widened.TreeDepth, wide.TreeDepth)
+	}
+}
+
+// favouriteMoveAllocator gives the whole remaining budget to the root child
+// playing move, once it exists
+type favouriteMoveAllocator struct {
+	move      interface{}
+	remaining []int
+	active    bool
+}
+
+func (a *favouriteMoveAllocator) Allocate(tree *Tree, totalBudget int) map[*Node]int {
+	a.remaining = append(a.remaining, totalBudget)
+	for _, child := range tree.Root.Children() {
+		if child.Sequence()[0] == a.move {
+			a.active = true
+			return map[*Node]int{child: totalBudget}
+		}
+	}
+	return nil
+}
+
+func TestBudgetAllocator(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	allocator := &favouriteMoveAllocator{move: 1}
+	inside, outside := 0, 0
+	fitness := func(seq []interface{}) float64 {
+		if allocator.active {
+			if seq[0] == allocator.move {
+				inside++
+			} else {
+				outside++
+			}
+		}
+		return problem.fitness(seq)
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          1000,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		Allocator:              allocator,
+		AllocationInterval:     100,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if len(allocator.remaining) != 10 || allocator.remaining[0] != 1000 || allocator.remaining[9] != 100 {
+		t.Errorf("Expected Allocate every 100 iterations with the remaining budget, got %v", allocator.remaining)
+	}
+	if inside == 0 || outside > 0 {
+		t.Errorf("Expected every rollout after allocation to start with move 1, got %d inside and %d outside", inside, outside)
+	}
+	if result.BestFitness != 0 {
+		t.Errorf("Expected an exact solution, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+	}
+}
+
+func TestSearcherPriorCache(t *testing.T) {
+	t.Run("LRU eviction", func(t *testing.T) {
+		cache := newPriorCache(2)
+		cache.put("a", []float64{1})
+		cache.put("b", []float64{2})
+		cache.get("a")
+		cache.put("c", []float64{3})
+
+		if _, ok := cache.get("b"); ok {
+			t.Error("Expected the least recently used state b to be evicted")
+		}
+		if _, ok := cache.get("a"); !ok {
+			t.Error("Expected the recently used state a to be kept")
+		}
+	})
+
+	t.Run("Repeated positions", func(t *testing.T) {
+		problem := &TestProblem{
+			targetSum:     15,
+			allowedDigits: []int{1, 2, 3, 4, 5},
+			maxLength:     4,
+		}
+
+		// Move order does not matter, so the state is the length and sum
+		statesVisited, priorCalls := 0, 0
+		config := Config{
+			ExplorationConstant: 2.0,
+			MaxIterations:       500,
+			TargetSeqLength:     4,
+			RandomSeed:          1,
+			UCTVariant:          UCTVariantPUCT,
+			PriorFunc: func(seq []interface{}, moves []interface{}) []float64 {
+				priorCalls++
+				priors := make([]float64, len(moves))
+				for i := range moves {
+					priors[i] = 1 / float64(len(moves))
+				}
+				return priors
+			},
+			StateKey: func(seq []interface{}) string {
+				statesVisited++
+				return fmt.Sprint(len(seq), sequenceSum(seq))
+			},
+			PriorCacheSize: 100,
+		}
+
+		searcher := NewSearcher(problem.nextElements, problem.fitness, config)
+		for turn := 0; turn < 3; turn++ {
+			if _, err := searcher.Run([]interface{}{}); err != nil {
+				t.Fatalf("Turn %d failed: %v", turn, err)
+			}
+		}
+
+		t.Logf("PriorFunc called %d times for %d visited states", priorCalls, statesVisited)
+		if statesVisited == 0 || priorCalls >= statesVisited {
+			t.Errorf("Expected cache hits to save PriorFunc calls, got %d calls for %d states", priorCalls, statesVisited)
+		}
+	})
+}
+
+func TestTranspositions(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+	// Move order does not matter, so the state is the sum of the moves
+	hash := func(seq []interface{}) uint64 {
+		return uint64(sequenceSum(seq))
+	}
+
+	t.Run("Equivalent sequences share a node", func(t *testing.T) {
+		config := Config{TargetSeqLength: 4, HashFunc: hash}
+		transpositions := &sync.Map{}
+		rng := rand.New(rand.NewSource(1))
+
+		root := &Node{sequence: []interface{}{}}
+		first := &Node{sequence: []interface{}{1}, parent: root, unusedMoves: []interface{}{2}}
+		second := &Node{sequence: []interface{}{2}, parent: root, unusedMoves: []interface{}{1}}
+		root.children = []*Node{first, second}
+
+		a := expansion(first, problem.nextElements, config, math.MaxFloat64, rng, transpositions)
+		b := expansion(second, problem.nextElements, config, math.MaxFloat64, rng, transpositions)
+
+		if a != b {
+			t.Fatalf("Expected [1 2] and [2 1] to share a node, got %v and %v", a.sequence, b.sequence)
+		}
+		if b.parent != second {
+			t.Errorf("Expected the shared node to point at its latest parent")
+		}
+		if len(first.children) != 1 || len(second.children) != 1 {
+			t.Errorf("Expected the shared node under both parents, got %d and %d children", len(first.children), len(second.children))
+		}
+	})
+
+	t.Run("StateKey keeps the first parent", func(t *testing.T) {
+		config := Config{
+			TargetSeqLength: 4,
+			StateKey:        func(seq []interface{}) string { return fmt.Sprint(sequenceSum(seq)) },
+			Transpositions:  true,
+		}
+		transpositions := &sync.Map{}
+		rng := rand.New(rand.NewSource(1))
+
+		root := &Node{sequence: []interface{}{}}
+		first := &Node{sequence: []interface{}{1}, parent: root, unusedMoves: []interface{}{2}}
+		second := &Node{sequence: []interface{}{2}, parent: root, unusedMoves: []interface{}{1}}
+		root.children = []*Node{first, second}
+
+		a := expansion(first, problem.nextElements, config, math.MaxFloat64, rng, transpositions)
+		b := expansion(second, problem.nextElements, config, math.MaxFloat64, rng, transpositions)
+		if a != b || len(second.children) != 1 {
+			t.Fatalf("Expected [1 2] and [2 1] to share a node, got %v and %v", a.sequence, b.sequence)
+		}
+		backpropagate(b, 1)
+
+		if selected := selection(second, 1.41, config, math.MaxFloat64, nil, nil); selected != b {
+			t.Fatalf("Expected the shared node to be selected below its second parent, got %v", selected.sequence)
+		}
+		if b.parent != first {
+			t.Errorf("Expected the shared node to keep its first parent")
+		}
+
+		// Without Transpositions StateKey only keys the prior cache
+		config.Transpositions = false
+		if usesTranspositions(&config) {
+			t.Error("Expected StateKey alone not to share nodes")
+		}
+		config.StateKey = nil
+		config.Transpositions = true
+		if err := config.Validate(); err == nil {
+			t.Error("Expected Transpositions without StateKey to be rejected")
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		config := Config{
+			ExplorationConstant:    2.0,
+			MaxIterations:          2000,
+			TargetSeqLength:        4,
+			RandomSeed:             1,
+			GuaranteeFullExpansion: true,
+			HashFunc:               hash,
+		}
+
+		root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+
+		unique := make(map[*Node]bool)
+		references := 1 // The root
+		Walk(root, func(node *Node) {
+			unique[node] = true
+			references += len(node.children)
+		})
+		if len(unique) >= references {
+			t.Errorf("Expected some nodes to be shared, got %d unique nodes for %d references", len(unique), references)
+		}
+		if result.TotalNodes != len(unique) {
+			t.Errorf("Expected TotalNodes to count the %d distinct nodes, got %d", len(unique), result.TotalNodes)
+		}
+		if result.BestFitness != 0 {
+			t.Errorf("Expected an exact solution, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+		}
+	})
+}
+
+func TestPUCTPolicy(t *testing.T) {
+	// Long sequences of digits summing to 100, best reached by playing 5 only
+	problem := &TestProblem{
+		targetSum:     100,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     20,
+	}
+	fitness := func(seq []interface{}) float64 {
+		return problem.fitness(seq) / 6400
+	}
+	informative := func(seq []interface{}, moves []interface{}) []float64 {
+		priors := make([]float64, len(moves))
+		for i, move := range moves {
+			if move == 5 {
+				priors[i] = 0.9
+			} else {
+				priors[i] = 0.1 / float64(len(moves)-1)
+			}
+		}
+		return priors
+	}
+
+	// Share of the root visits spent on the high-prior move
+	highPriorShare := func(variant string) float64 {
+		share := 0.0
+		for seed := int64(0); seed < 10; seed++ {
+			config := Config{
+				ExplorationConstant:    1.41,
+				MaxIterations:          100,
+				TargetSeqLength:        20,
+				RandomSeed:             seed,
+				GuaranteeFullExpansion: true,
+				UCTVariant:             variant,
+				PriorFunc:              informative,
+			}
+
+			root, _, err := search(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			for _, child := range root.children {
+				if child.sequence[0] == 5 {
+					share += float64(child.visits) / float64(root.visits)
+				}
+			}
+		}
+		return share / 10
+	}
+
+	uct := highPriorShare(UCTVariantUCB1)
+	puct := highPriorShare(UCTVariantPUCT)
+	t.Logf("Visit share of the high-prior move: UCT %.3f, PUCT %.3f", uct, puct)
+
+	if puct < 0.75 || puct < 2*uct {
+		t.Errorf("Expected PUCT to concentrate visits on the high-prior move, got %.3f (UCT %.3f)", puct, uct)
+	}
+}
+
+func TestDecisionSummary(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          1000,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	summary := DecisionSummary(result)
+	if summary.Chosen.Move != result.BestSequence[0] {
+		t.Errorf("Expected chosen move %v, got %v", result.BestSequence[0], summary.Chosen.Move)
+	}
+	if summary.Iterations != result.Iterations {
+		t.Errorf("Expected %d iterations, got %d", result.Iterations, summary.Iterations)
+	}
+	if len(summary.Alternatives) != 3 {
+		t.Errorf("Expected 3 alternatives, got %d", len(summary.Alternatives))
+	}
+	if summary.Confidence <= 0 || summary.Confidence > 1 {
+		t.Errorf("Expected confidence in (0,1], got %f", summary.Confidence)
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !json.Valid(data) {
+		t.Fatalf("Invalid JSON: %s", data)
+	}
+
+	var decoded struct {
+		Chosen struct {
+			Move int `json:"move"`
+		} `json:"chosen"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if decoded.Chosen.Move != result.BestSequence[0] {
+		t.Errorf("Expected JSON chosen move %v, got %s", result.BestSequence[0], data)
+	}
+}
+
+func TestOnIteration(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	var calls []int
+	lastBest, lastNodes := math.MaxFloat64, 0
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       200,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+		OnIteration: func(i int, stats ProgressStats) {
+			calls = append(calls, i)
+			if stats.Iterations != i+1 {
+				t.Errorf("Iteration %d: expected stats for %d iterations, got %d", i, i+1, stats.Iterations)
+			}
+			if stats.BestFitness > lastBest {
+				t.Errorf("Iteration %d: best fitness went up from %f to %f", i, lastBest, stats.BestFitness)
+			}
+			lastBest, lastNodes = stats.BestFitness, stats.TotalNodes
+			for j := range stats.BestSequence {
+				stats.BestSequence[j] = -1 // Must not leak into the search
+			}
+		},
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if len(calls) != config.MaxIterations {
+		t.Fatalf("Expected %d calls, got %d", config.MaxIterations, len(calls))
+	}
+	for i, call := range calls {
+		if call != i {
+			t.Fatalf("Expected call %d for iteration %d, got %d", i, i, call)
+		}
+	}
+	for _, move := range result.BestSequence {
+		if move == -1 {
+			t.Fatalf("Callback modified the best sequence: %v", result.BestSequence)
+		}
+	}
+	if lastNodes != result.TotalNodes {
+		t.Errorf("Expected the last stats to count %d nodes, got %d", result.TotalNodes, lastNodes)
+	}
+}
+
+func TestRAVEIterationsToTarget(t *testing.T) {
+	// Only 9, 9, 9, 9, 9 reaches the target, in any order of discovery
+	problem := &TestProblem{
+		targetSum:     45,
+		allowedDigits: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		maxLength:     5,
+	}
+
+	// Average number of iterations until the target sum is hit
+	iterationsToTarget := func(policy SelectionPolicy) int {
+		total := 0
+		for seed := int64(0); seed < 20; seed++ {
+			hit := 0
+			config := Config{
+				ExplorationConstant:    2.0,
+				MaxIterations:          3000,
+				TargetSeqLength:        5,
+				RandomSeed:             seed,
+				GuaranteeFullExpansion: true,
+				Policy:                 policy,
+				RAVEBias:               0.01,
+				OnIteration: func(i int, stats ProgressStats) {
+					if hit == 0 && stats.BestFitness == 0 {
+						hit = i + 1
+					}
+				},
+			}
+
+			if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			if hit == 0 {
+				hit = config.MaxIterations
+			}
+			total += hit
+		}
+		return total / 20
+	}
+
+	uct := iterationsToTarget(PolicyUCT)
+	rave := iterationsToTarget(PolicyRAVE)
+	t.Logf("Iterations to hit the target: UCT %d, RAVE %d", uct, rave)
+
+	if rave >= uct {
+		t.Errorf("Expected RAVE to hit the target in fewer iterations than UCT, got %d >= %d", rave, uct)
+	}
+}
+
+func TestStopOnThreshold(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	logger := &bufferLogger{}
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          2000,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		DebugLevel:             1,
+		Logger:                 logger,
+		GuaranteeFullExpansion: true,
+		FitnessThreshold:       0,
+		StopOnThreshold:        true,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("Expected a nil error on early exit, got %v", err)
+	}
+	if result.BestFitness != 0 {
+		t.Fatalf("Expected the search to reach the threshold, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+	}
+	if result.Iterations >= config.MaxIterations {
+		t.Errorf("Expected an early exit, ran all %d iterations", result.Iterations)
+	}
+	if !strings.Contains(logger.String(), "Reached fitness threshold") {
+		t.Errorf("Expected the early exit to be logged, got %q", logger.String())
+	}
+}
+
+func TestProgressiveWideningFollowsVisits(t *testing.T) {
+	digits := make([]int, 200)
+	for i := range digits {
+		digits[i] = i
+	}
+	problem := &TestProblem{
+		targetSum:     1000,
+		allowedDigits: digits,
+		maxLength:     10,
+	}
+
+	config := Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       2000,
+		TargetSeqLength:     10,
+		RandomSeed:          1,
+		ProgressiveWidening: true,
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	// Every inner node is exactly as wide as its visits allow, give or take
+	// the child its last visit entitled it to, so width goes where visits go
+	widest := root
+	Walk(root, func(node *Node) {
+		if len(node.sequence) >= config.TargetSeqLength || node.visits == 0 {
+			return
+		}
+		limit := int(math.Max(1, math.Floor(math.Sqrt(float64(node.visits)))))
+		if len(node.children) < limit-1 || len(node.children) > limit {
+			t.Errorf("Node %v has %d children for %d visits, want %d or %d", node.sequence, len(node.children), node.visits, limit-1, limit)
+		}
+		if len(node.children) > len(widest.children) {
+			widest = node
+		}
+	})
+
+	t.Logf("Depth %d, %d nodes, %d root children", result.TreeDepth, result.TotalNodes, len(root.children))
+	if widest != root {
+		t.Errorf("Expected the most visited root to be the widest node, got %v with %d children", widest.sequence, len(widest.children))
+	}
+	if result.TreeDepth < config.TargetSeqLength {
+		t.Errorf("Expected the tree to reach depth %d, got %d", config.TargetSeqLength, result.TreeDepth)
+	}
+}
+
+func TestRunMultiObjective(t *testing.T) {
+	t.Run("Hypervolume", func(t *testing.T) {
+		points := [][]float64{{1, 3}, {2, 2}, {3, 1}}
+		if volume := hypervolume(points, []float64{4, 4}); volume != 6 {
+			t.Errorf("Expected hypervolume 6, got %f", volume)
+		}
+		if volume := hypervolume([][]float64{{1, 1, 1}}, []float64{2, 3, 4}); volume != 6 {
+			t.Errorf("Expected hypervolume 6, got %f", volume)
+		}
+	})
+
+	t.Run("Front", func(t *testing.T) {
+		front := &paretoFront{}
+		add := func(sequence []interface{}, objectives []float64) float64 {
+			gain, err := front.add(sequence, objectives)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			return gain
+		}
+		if gain := add([]interface{}{1}, []float64{2, 2}); gain <= 0 {
+			t.Errorf("Expected the first solution to add hypervolume, got %f", gain)
+		}
+		if gain := add([]interface{}{2}, []float64{3, 3}); gain != 0 {
+			t.Errorf("Expected a dominated solution to add nothing, got %f", gain)
+		}
+		if gain := add([]interface{}{3}, []float64{1, 3}); gain <= 0 {
+			t.Errorf("Expected a trade-off solution to add hypervolume, got %f", gain)
+		}
+		// The front covered 5 of the 9 units below the reference point 4, 4
+		if gain := add([]interface{}{4}, []float64{1, 1}); gain != 4 {
+			t.Errorf("Expected a dominating solution to add hypervolume 4, got %f", gain)
+		}
+		if len(front.solutions) != 1 || front.solutions[0].Sequence[0] != 4 {
+			t.Errorf("Expected the dominating solution to replace the front, got %v", front.solutions)
+		}
+		if _, err := front.add([]interface{}{5}, []float64{1, 1, 1}); err == nil {
+			t.Error("Expected an error for a different number of objectives")
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		problem := &TestProblem{
+			targetSum:     15,
+			allowedDigits: []int{1, 2, 3, 4, 5},
+			maxLength:     4,
+		}
+
+		// Minimize the sum while maximizing the number of distinct digits
+		objectives := func(seq []interface{}) []float64 {
+			distinct := make(map[interface{}]bool)
+			for _, move := range seq {
+				distinct[move] = true
+			}
+			return []float64{float64(sequenceSum(seq)), -float64(len(distinct))}
+		}
+
+		config := Config{
+			ExplorationConstant:    2.0,
+			MaxIterations:          2000,
+			TargetSeqLength:        4,
+			RandomSeed:             1,
+			GuaranteeFullExpansion: true,
+		}
+
+		front, err := RunMultiObjective([]interface{}{}, problem.nextElements, objectives, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+
+		for i, a := range front {
+			if fmt.Sprint(objectives(a.Sequence)) != fmt.Sprint(a.Objectives) {
+				t.Errorf("Objectives %v do not match sequence %v", a.Objectives, a.Sequence)
+			}
+			for j, b := range front {
+				if i != j && dominates(a.Objectives, b.Objectives) {
+					t.Errorf("Solution %v dominates %v on the front", a.Sequence, b.Sequence)
+				}
+			}
+		}
+
+		if len(front) < 2 {
+			t.Errorf("Expected the front to trade the sum off against distinct digits, got %v", front)
+		}
+	})
+
+	t.Run("Objective count mismatch", func(t *testing.T) {
+		problem := &TestProblem{
+			targetSum:     15,
+			allowedDigits: []int{1, 2, 3, 4, 5},
+			maxLength:     4,
+		}
+		// Sequences starting with 5 get a third objective
+		objectives := func(seq []interface{}) []float64 {
+			if seq[0] == 5 {
+				return []float64{1, 2, 3}
+			}
+			return []float64{1, 2}
+		}
+
+		config := Config{
+			MaxIterations:          200,
+			TargetSeqLength:        4,
+			RandomSeed:             1,
+			GuaranteeFullExpansion: true,
+		}
+		if _, err := RunMultiObjective([]interface{}{}, problem.nextElements, objectives, config); err == nil || !strings.Contains(err.Error(), "objectives") {
+			t.Errorf("Expected an error for the differing objective counts, got %v", err)
+		}
+	})
+}
+
+func TestReuseTree(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     30,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     10,
+	}
+
+	config := Config{
+		ExplorationConstant:    200, // Squared errors reach hundreds, keep exploring instead of diving to a leaf
+		MaxIterations:          500,
+		TargetSeqLength:        10,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	if _, err := AdvanceRoot(result.Root, 7); err == nil {
+		t.Error("Expected an error advancing by a move that was never expanded")
+	}
+
+	move := mostVisitedChild(result.Root).sequence[0]
+	root, err := AdvanceRoot(result.Root, move)
+	if err != nil {
+		t.Fatalf("AdvanceRoot failed with error: %v", err)
+	}
+	if root.parent != nil {
+		t.Error("Expected the new root to be detached from its parent")
+	}
+	if len(result.Root.Children()) != 0 {
+		t.Error("Expected the siblings of the new root to be discarded")
+	}
+
+	visits := root.Visits()
+	if visits == 0 {
+		t.Fatal("Expected the chosen child to have been visited")
+	}
+
+	config.ReuseTree = root
+	reused, err := RunDetailed(context.Background(), nil, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if reused.Root != root {
+		t.Fatal("Expected the search to continue the reused tree")
+	}
+	if got := root.Visits(); got != visits+config.MaxIterations {
+		t.Errorf("Expected %d visits carried over plus %d new ones, got %d", visits, config.MaxIterations, got)
+	}
+	if len(reused.BestSequence) != 10 || reused.BestSequence[0] != move {
+		t.Errorf("Expected a complete sequence starting with %v, got %v", move, reused.BestSequence)
+	}
+}
+
+func TestRolloutPolicyFallback(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	logger := &bufferLogger{}
+	config := Config{
+		MaxIterations:   50,
+		TargetSeqLength: 4,
+		RandomSeed:      1,
+		DebugLevel:      1,
+		Logger:          logger,
+		RolloutPolicy: func(sequence []interface{}, moves []interface{}) interface{} {
+			return 7 // Never an allowed digit
+		},
+	}
+
+	sequence, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if len(sequence) != 4 {
+		t.Fatalf("Expected a complete sequence, got %v", sequence)
+	}
+	for _, move := range sequence {
+		if !containsMove(problem.nextElements(nil), move) {
+			t.Errorf("Expected only allowed digits, got %v", sequence)
+		}
+	}
+	if !strings.Contains(logger.String(), "RolloutPolicy returned 7") {
+		t.Errorf("Expected a warning about the invalid rollout move, got %q", logger.String())
+	}
+
+	// Returning nil leaves a move to chance without a warning
+	logger = &bufferLogger{}
+	config.Logger = logger
+	guided, random := 0, 0
+	config.RolloutPolicy = func(sequence []interface{}, moves []interface{}) interface{} {
+		if len(sequence)%2 == 0 {
+			guided++
+			return 5
+		}
+		random++
+		return nil
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if guided == 0 || random == 0 || len(result.BestSequence) != 4 {
+		t.Errorf("Expected guided and random rollout moves, got %d and %d", guided, random)
+	}
+	if logger.String() != "" {
+		t.Errorf("Expected no warning for nil rollout moves, got %q", logger.String())
+	}
+}
+
+func TestMaxSimulationDepth(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     60,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     20,
+	}
+
+	// Record rollout lengths until the last iteration, the sequence built
+	// when no rollout completed is evaluated afterwards
+	const maxDepth = 3
+	var lengths []int
+	searching := true
+	fitness := func(seq []interface{}) float64 {
+		if searching {
+			lengths = append(lengths, len(seq))
+		}
+		return problem.fitness(seq)
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          200,
+		TargetSeqLength:        20,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		MaxSimulationDepth:     maxDepth,
+		RolloutPrefix: func(seq []interface{}) []interface{} {
+			return []interface{}{1, 1, 1, 1, 1}
+		},
+	}
+	config.OnIteration = func(i int, stats ProgressStats) {
+		searching = i+1 < config.MaxIterations
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	// Every rollout starts from an expanded node, at most TreeDepth deep
+	if len(lengths) == 0 {
+		t.Fatal("Expected rollouts to be evaluated")
+	}
+	for _, length := range lengths {
+		if length > result.TreeDepth+maxDepth {
+			t.Fatalf("Rollout of %d moves exceeds tree depth %d plus the cap of %d", length, result.TreeDepth, maxDepth)
+		}
+	}
+
+	// Truncated rollouts must never be reported as the best sequence
+	if len(result.BestSequence) != 20 {
+		t.Errorf("Expected a complete best sequence, got %v", result.BestSequence)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	root := &Node{sequence: []interface{}{2}}
+	if rollout := simulation(root, problem.nextElements, config, rng); len(rollout) != 1+maxDepth {
+		t.Errorf("Expected a rollout of %d moves from %v, got %v", maxDepth, root.sequence, rollout)
+	}
+	config.MaxSimulationDepth = 0
+	if rollout := simulation(root, problem.nextElements, config, rng); len(rollout) != 20 {
+		t.Errorf("Expected an uncapped rollout to complete the sequence, got %v", rollout)
+	}
+}
+
+// keepAllPrune never selects a subtree, so the tree is never pruned
+type keepAllPrune struct {
+	calls int
+}
+
+func (p *keepAllPrune) SelectPrune(tree *Tree, bestSequence []interface{}) *Node {
+	p.calls++
+	return nil
+}
+
+func TestMaxNodes(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     30,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     10,
+	}
+
+	const maxNodes = 40
+	config := Config{
+		ExplorationConstant:    200, // Squared errors reach hundreds, keep exploring instead of diving to a leaf
+		MaxIterations:          3000,
+		TargetSeqLength:        10,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		MaxNodes:               maxNodes,
+	}
+
+	// The tree is pruned right after each expansion, never later
+	exceeded := 0
+	config.OnIteration = func(i int, stats ProgressStats) {
+		if stats.TotalNodes > maxNodes {
+			exceeded++
+		}
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if result.TotalNodes != maxNodes {
+		t.Errorf("Expected the tree to be held at %d nodes, got %d", maxNodes, result.TotalNodes)
+	}
+	if exceeded > 0 {
+		t.Errorf("Expected at most %d nodes after every iteration, exceeded %d times", maxNodes, exceeded)
+	}
+	if result.Root.visits != config.MaxIterations {
+		t.Errorf("Expected pruning to keep the %d root visits, got %d", config.MaxIterations, result.Root.visits)
+	}
+	if len(result.BestSequence) != 10 {
+		t.Errorf("Expected a complete best sequence, got %v", result.BestSequence)
+	}
+
+	// Pruned moves are given back for expansion
+	Walk(result.Root, func(node *Node) {
+		if moves := len(node.children) + len(node.unusedMoves); moves > len(problem.allowedDigits) {
+			t.Errorf("Node %v has %d children and unused moves, expected at most %d",
+				node.sequence, moves, len(problem.allowedDigits))
+		}
+	})
+
+	policy := &keepAllPrune{}
+	config.OnIteration = nil
+	config.PrunePolicy = policy
+	result, err = RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if policy.calls == 0 || result.TotalNodes <= maxNodes {
+		t.Errorf("Expected the policy to be asked and to keep all %d nodes, got %d calls", result.TotalNodes, policy.calls)
+	}
+
+	// Leaves go first on ties, then the least visited subtree
+	root := &Node{sequence: []interface{}{}}
+	busy := &Node{sequence: []interface{}{1}, parent: root, visits: 5}
+	quiet := &Node{sequence: []interface{}{2}, parent: root, visits: 2}
+	leaf := &Node{sequence: []interface{}{2, 1}, parent: quiet, visits: 2}
+	root.children = []*Node{busy, quiet}
+	quiet.children = []*Node{leaf}
+	if selected := (FewestVisitsPrune{}).SelectPrune(&Tree{Root: root}, nil); selected != leaf {
+		t.Errorf("Expected the leaf %v to be pruned first, got %v", leaf.sequence, selected.sequence)
+	}
+	if selected := (FewestVisitsPrune{}).SelectPrune(&Tree{Root: root}, []interface{}{2, 1, 3}); selected != busy {
+		t.Errorf("Expected the best path to be kept and %v pruned, got %v", busy.sequence, selected.sequence)
+	}
+}
+
+func TestRolloutEpsilon(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     10,
+	}
+
+	// policyShare reports the share of rollout moves that followed a policy
+	// always playing 1
+	policyShare := func(epsilon float64) float64 {
+		config := Config{
+			TargetSeqLength: 10,
+			RolloutPolicy: func(sequence []interface{}, moves []interface{}) interface{} {
+				return 1
+			},
+			RolloutEpsilon: epsilon,
+		}
+		rng := rand.New(rand.NewSource(1))
+		root := &Node{sequence: []interface{}{}}
+
+		ones, total := 0, 0
+		for i := 0; i < 200; i++ {
+			for _, move := range simulation(root, problem.nextElements, config, rng) {
+				if move == 1 {
+					ones++
+				}
+				total++
+			}
+		}
+		// Random moves play 1 a fifth of the time
+		return (float64(ones)/float64(total) - 0.2) / 0.8
+	}
+
+	greedy, mixed, random := policyShare(0), policyShare(0.5), policyShare(1)
+	t.Logf("Share of policy moves: epsilon 0 %.2f, 0.5 %.2f, 1 %.2f", greedy, mixed, random)
+
+	if greedy != 1 {
+		t.Errorf("Expected every move to follow the policy with epsilon 0, got %.2f", greedy)
+	}
+	if math.Abs(mixed-0.5) > 0.1 {
+		t.Errorf("Expected about half of the moves to follow the policy with epsilon 0.5, got %.2f", mixed)
+	}
+	if math.Abs(random) > 0.1 {
+		t.Errorf("Expected no moves to follow the policy with epsilon 1, got %.2f", random)
+	}
+	if mixed != policyShare(0.5) {
+		t.Error("Expected rollouts with the same seed to be reproducible")
+	}
+}
+
+func TestRunTopK(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          2000,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		TopK:                   5,
+	}
+
+	if _, err := RunTopK([]interface{}{}, problem.nextElements, problem.fitness, Config{MaxIterations: 10, TargetSeqLength: 4}); err == nil {
+		t.Error("Expected an error without TopK")
+	}
+
+	results, err := RunTopK([]interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if len(results) != config.TopK {
+		t.Fatalf("Expected %d sequences, got %v", config.TopK, results)
+	}
+
+	seen := make(map[string]bool)
+	for i, result := range results {
+		if len(result.Sequence) != 4 || result.Fitness != problem.fitness(result.Sequence) {
+			t.Errorf("Sequence %v does not match its fitness %f", result.Sequence, result.Fitness)
+		}
+		if key := fmt.Sprint(result.Sequence); seen[key] {
+			t.Errorf("Sequence %v reported twice", result.Sequence)
+		} else {
+			seen[key] = true
+		}
+		if i > 0 && result.Fitness < results[i-1].Fitness {
+			t.Errorf("Expected results sorted best first, got %v", results)
+		}
+	}
+	if results[0].Fitness != 0 {
+		t.Errorf("Expected the best sequence to hit the target, got %v", results[0])
+	}
+
+	t.Run("Bounded", func(t *testing.T) {
+		top := newTopSequences(2, Config{Maximize: true})
+		top.add([]interface{}{1}, 1)
+		top.add([]interface{}{2}, 3)
+		top.add([]interface{}{2}, 3)
+		top.add([]interface{}{3}, 2)
+		top.add([]interface{}{4}, 0)
+
+		got := top.sorted()
+		if len(got) != 2 || got[0].Fitness != 3 || got[1].Fitness != 2 {
+			t.Errorf("Expected the two highest distinct fitnesses 3 and 2, got %v", got)
+		}
+		if top.keys["[1]"] {
+			t.Error("Expected an evicted sequence to be forgotten")
+		}
+
+		// A lossy display hook does not merge distinct sequences
+		top = newTopSequences(2, Config{SequenceToString: func(sequence []interface{}) string { return "same" }})
+		top.add([]interface{}{1}, 1)
+		top.add([]interface{}{2}, 2)
+		if got := top.sorted(); len(got) != 2 {
+			t.Errorf("Expected both distinct sequences to be kept, got %v", got)
+		}
+	})
+
+	t.Run("FewerThanK", func(t *testing.T) {
+		// K above the number of distinct complete sequences rolled out
+		distinct := make(map[string]bool)
+		fitness := func(sequence []interface{}) float64 {
+			if len(sequence) == problem.maxLength {
+				distinct[fmt.Sprint(sequence)] = true
+			}
+			return problem.fitness(sequence)
+		}
+		config := config
+		config.MaxIterations = 100
+		config.TopK = 1000
+
+		result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+		if len(result.TopSequences) != len(distinct) {
+			t.Errorf("Expected all %d distinct sequences, got %d", len(distinct), len(result.TopSequences))
+		}
+	})
+}
+
+func TestBackupMax(t *testing.T) {
+	// A branch holding one great leaf among poor siblings against a branch
+	// of uniformly mediocre leaves
+	root := &Node{sequence: []interface{}{}}
+	lucky := &Node{sequence: []interface{}{1}, parent: root}
+	steady := &Node{sequence: []interface{}{2}, parent: root}
+	root.children = []*Node{lucky, steady}
+	for i, fitness := range []float64{0, 10, 10, 10} {
+		leaf := &Node{sequence: []interface{}{1, i}, parent: lucky}
+		lucky.children = append(lucky.children, leaf)
+		backpropagate(leaf, fitness)
+	}
+	for i := 0; i < 4; i++ {
+		leaf := &Node{sequence: []interface{}{2, i}, parent: steady}
+		steady.children = append(steady.children, leaf)
+		backpropagate(leaf, 5)
+	}
+
+	if lucky.minFitness != 0 || lucky.maxFitness != 10 || root.minFitness != 0 || root.maxFitness != 10 {
+		t.Errorf("Expected fitness extremes 0 and 10, got %v %v at %v and %v %v at the root",
+			lucky.minFitness, lucky.maxFitness, lucky.sequence, root.minFitness, root.maxFitness)
+	}
+
+	config := Config{TargetSeqLength: 2}
+	if selected := selection(root, 0.1, config, math.MaxFloat64, nil, nil); selected.sequence[0] != 2 {
+		t.Errorf("Expected BackupMean to follow the better average, got %v", selected.sequence)
+	}
+	config.BackupStrategy = BackupMax
+	if selected := selection(root, 0.1, config, math.MaxFloat64, nil, nil); selected.sequence[0] != 1 {
+		t.Errorf("Expected BackupMax to follow the best leaf, got %v", selected.sequence)
+	}
+	config.Maximize = true
+	if selected := selection(root, 0.1, config, 0, nil, nil); selected.sequence[0] != 1 {
+		t.Errorf("Expected BackupMax to follow the highest leaf when maximizing, got %v", selected.sequence)
+	}
+
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+	search := Config{
+		ExplorationConstant:    4.0,
+		MaxIterations:          300,
+		TargetSeqLength:        4,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		BackupStrategy:         BackupMax,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, search)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if result.BestFitness != 0 {
+		t.Errorf("Expected BackupMax to hit the target sum, got %v with fitness %f", result.BestSequence, result.BestFitness)
+	}
+
+	search.BackupStrategy = "median"
+	if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, search); err == nil {
+		t.Error("Expected an error for an unknown BackupStrategy")
+	}
+}
+
+func TestConfigRand(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     6,
+	}
+
+	// visitsOf describes the first level of the tree, which depends on
+	// every random choice of the search
+	visitsOf := func(config Config) string {
+		result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Errorf("MCTS failed with error: %v", err)
+			return ""
+		}
+		var description []string
+		for _, child := range result.Root.Children() {
+			description = append(description, fmt.Sprintf("%v:%d", child.sequence[0], child.Visits()))
+		}
+		return fmt.Sprint(result.BestSequence, description)
+	}
+
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          300,
+		TargetSeqLength:        6,
+		RandomSeed:             7,
+		GuaranteeFullExpansion: true,
+	}
+	seeded := visitsOf(config)
+
+	config.RandomSeed = 0
+	config.Rand = rand.New(rand.NewSource(7))
+	if got := visitsOf(config); got != seeded {
+		t.Errorf("Expected Rand seeded with 7 to search like RandomSeed 7, got %s and %s", got, seeded)
+	}
+
+	// Searches with their own sources do not interfere when run concurrently
+	var wg sync.WaitGroup
+	results := make([]string, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			concurrent := config
+			concurrent.Rand = rand.New(rand.NewSource(7))
+			results[i] = visitsOf(concurrent)
+		}(i)
+	}
+	wg.Wait()
+	for _, got := range results {
+		if got != seeded {
+			t.Errorf("Expected concurrent searches to be reproducible, got %s and %s", got, seeded)
+		}
+	}
+
+	config.Parallelism = 4
+	config.Rand = rand.New(rand.NewSource(7))
+	if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err != nil {
+		t.Fatalf("Parallel MCTS failed with error: %v", err)
+	}
+}
+
+func TestEnableMemoization(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     12,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     3,
+	}
+
+	evaluated := make(map[string]int)
+	fitness := func(seq []interface{}) float64 {
+		evaluated[fmt.Sprint(seq)]++
+		return problem.fitness(seq)
+	}
+
+	var last ProgressStats
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          1000,
+		TargetSeqLength:        3,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		EnableMemoization:      true,
+		OnIteration: func(i int, stats ProgressStats) {
+			last = stats
+		},
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if result.BestFitness != 0 {
+		t.Errorf("Expected the target sum to be found, got %v", result.BestSequence)
+	}
+	for sequence, calls := range evaluated {
+		if calls > 1 {
+			t.Errorf("Sequence %s was evaluated %d times", sequence, calls)
+		}
+	}
+	if last.CacheHitRate <= 0 || last.CacheHitRate >= 1 {
+		t.Errorf("Expected a cache hit rate between 0 and 1, got %f", last.CacheHitRate)
+	}
+
+	// Sequences with equal keys share a single evaluation
+	sums := make(map[int]bool)
+	config.SequenceKey = func(seq []interface{}) string {
+		return fmt.Sprint(sequenceSum(seq))
+	}
+	config.OnIteration = nil
+	fitness = func(seq []interface{}) float64 {
+		if sum := sequenceSum(seq); sums[sum] {
+			t.Errorf("Sum %d was evaluated twice", sum)
+		} else {
+			sums[sum] = true
+		}
+		return problem.fitness(seq)
+	}
+	if _, err := Run([]interface{}{}, problem.nextElements, fitness, config); err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+
+	// Rollouts scored by FitnessResultFunc or IncrementalFitness are cached too
+	config.SequenceKey = nil
+	for name, evaluator := range map[string]func(config *Config, evaluated map[string]int){
+		"FitnessResultFunc": func(config *Config, evaluated map[string]int) {
+			config.FitnessResultFunc = func(seq []interface{}) FitnessResult {
+				evaluated[fmt.Sprint(seq)]++
+				return FitnessResult{Value: problem.fitness(seq)}
+			}
+		},
+		"IncrementalFitness": func(config *Config, evaluated map[string]int) {
+			config.IncrementalFitness = func(fitness float64, seq []interface{}, move interface{}) float64 {
+				return problem.fitness(append(seq[:len(seq):len(seq)], move))
+			}
+		},
+	} {
+		evaluator := evaluator
+		t.Run(name, func(t *testing.T) {
+			evaluated := make(map[string]int)
+			config := config
+			config.OnIteration = func(i int, stats ProgressStats) {
+				last = stats
+			}
+			evaluator(&config, evaluated)
+			if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			for sequence, calls := range evaluated {
+				if calls > 1 {
+					t.Errorf("Sequence %s was evaluated %d times", sequence, calls)
+				}
+			}
+			if last.CacheHitRate <= 0 {
+				t.Errorf("Expected rollouts to be answered from the cache, got a hit rate of %f", last.CacheHitRate)
+			}
+		})
+	}
+}
+
+func TestProgressLogger(t *testing.T) {
+	logger := &bufferLogger{}
+	config := Config{
+		DebugLevel:       2,
+		Logger:           logger,
+		SequenceToString: func(seq []interface{}) string { return fmt.Sprintf("digits %v", seq) },
+	}
+
+	printProgress(ProgressStats{
+		Iterations:   42,
+		BestFitness:  1.5,
+		BestSequence: []interface{}{1, 2},
+		TreeDepth:    3,
+		TotalNodes:   17,
+	}, config)
+
+	output := logger.String()
+	for _, line := range []string{
+		"=== Progress Report (Iteration 42) ===",
+		"Best Fitness: 1.500000",
+		"Tree Depth: 3",
+		"Total Nodes: 17",
+		"Best Sequence: digits [1 2]",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected %q in the progress report, got %q", line, output)
+		}
+	}
+}
+
+func TestBackupStrategies(t *testing.T) {
+	// The volatile branch saw the best, the worst and the latest good
+	// rollout; the steady branch always scored 5
+	root := &Node{sequence: []interface{}{}}
+	volatile := &Node{sequence: []interface{}{1}, parent: root}
+	steady := &Node{sequence: []interface{}{2}, parent: root}
+	root.children = []*Node{volatile, steady}
+	for _, fitness := range []float64{10, 0, 10, 3} {
+		backpropagate(volatile, fitness)
+		backpropagate(steady, 5)
+	}
+
+	tests := []struct {
+		strategy BackupStrategy
+		maximize bool
+		expected interface{}
+	}{
+		{BackupMean, false, 2}, // Means 5.75 and 5
+		{BackupMax, false, 1},  // Best 0 beats 5
+		{BackupMin, false, 2},  // Worst 10 loses to 5
+		{BackupLast, false, 1}, // Latest 3 beats 5
+		{BackupMean, true, 1},  // Mean 5.75 beats 5
+		{BackupMax, true, 1},   // Best 10 beats 5
+		{BackupMin, true, 2},   // Worst 0 loses to 5
+		{BackupLast, true, 2},  // Latest 3 loses to 5
+	}
+	for _, tt := range tests {
+		config := Config{TargetSeqLength: 1, BackupStrategy: tt.strategy, Maximize: tt.maximize}
+		selected := selection(root, 0.01, config, worstFitness(tt.maximize), nil, nil)
+		if selected.sequence[0] != tt.expected {
+			t.Errorf("%s (maximize %v): expected move %v, got %v", tt.strategy, tt.maximize, tt.expected, selected.sequence)
+		}
+	}
+
+	if volatile.lastFitness != 3 || volatile.visits != 4 || volatile.totalFitness != 23 {
+		t.Errorf("Expected visits and totals to be kept for every strategy, got %d visits, total %v, last %v",
+			volatile.visits, volatile.totalFitness, volatile.lastFitness)
+	}
+}
+
+func TestOnProgress(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	for _, tt := range []struct {
+		interval int
+		expected []int
+	}{
+		{interval: 0, expected: []int{100, 200, 300}}, // Defaults to every 100 iterations
+		{interval: 120, expected: []int{120, 240}},
+	} {
+		var reported []int
+		config := Config{
+			ExplorationConstant: 2.0,
+			MaxIterations:       350,
+			TargetSeqLength:     4,
+			RandomSeed:          1,
+			ProgressInterval:    tt.interval,
+			OnProgress: func(stats ProgressStats) {
+				reported = append(reported, stats.Iterations)
+				if len(stats.BestSequence) > 0 {
+					stats.BestSequence[0] = "corrupted" // Must not reach the search
+				}
+			},
+		}
+
+		result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed with error: %v", err)
+		}
+		if fmt.Sprint(reported) != fmt.Sprint(tt.expected) {
+			t.Errorf("Interval %d: expected reports after iterations %v, got %v", tt.interval, tt.expected, reported)
+		}
+		for _, move := range result.BestSequence {
+			if move == "corrupted" {
+				t.Fatalf("Mutating the reported stats changed the best sequence %v", result.BestSequence)
+			}
+		}
+	}
+}
+
+func TestDiscountFactor(t *testing.T) {
+	// Every way of reaching a sum of 3 scores the same, so only the discount
+	// can tell the one-move sequence from the longer ones
+	nextElements := func(sequence []interface{}) []interface{} { return []interface{}{1, 3} }
+	terminated := func(sequence []interface{}) bool {
+		sum := 0
+		for _, move := range sequence {
+			sum += move.(int)
+		}
+		return sum >= 3
+	}
+
+	for _, maximize := range []bool{false, true} {
+		config := Config{
+			ExplorationConstant:    1.41,
+			MaxIterations:          200,
+			TargetSeqLength:        -1,
+			IsSequenceTerminated:   terminated,
+			GuaranteeFullExpansion: true,
+			Maximize:               maximize,
+			DiscountFactor:         0.9,
+			RandomSeed:             1,
+		}
+		result, err := RunDetailed(context.Background(), []interface{}{}, nextElements,
+			func(sequence []interface{}) float64 { return 1 }, config)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.BestFitness != 1 {
+			t.Errorf("Maximize %v: expected raw best fitness 1, got %v", maximize, result.BestFitness)
+		}
+
+		var short, long *Node
+		for _, child := range result.Root.Children() {
+			if child.Sequence()[0] == 3 {
+				short = child
+			} else {
+				long = child
+			}
+		}
+		if short == nil || long == nil {
+			t.Fatalf("Maximize %v: expected both moves to be expanded", maximize)
+		}
+		if !isBetter(maximize, short.MeanFitness(), long.MeanFitness()) {
+			t.Errorf("Maximize %v: expected the short sequence to be valued higher, got %v vs %v",
+				maximize, short.MeanFitness(), long.MeanFitness())
+		}
+		// The rollout that ended at the short sequence's node leaves nothing
+		// to discount there
+		if best := map[bool]float64{false: short.minFitness, true: short.maxFitness}[maximize]; best != 1 {
+			t.Errorf("Maximize %v: expected the short sequence to keep its raw fitness 1, got %v", maximize, best)
+		}
+		for _, leaf := range long.Children() {
+			if leaf.Visits() > 0 && isBetter(maximize, long.MeanFitness(), leaf.MeanFitness()) {
+				t.Errorf("Maximize %v: expected %v to be discounted more than its child %v, got %v vs %v",
+					maximize, long.Sequence(), leaf.Sequence(), long.MeanFitness(), leaf.MeanFitness())
+			}
+		}
+	}
+
+	config := Config{MaxIterations: 1, TargetSeqLength: 1, DiscountFactor: 1.5}
+	if _, err := RunDetailed(context.Background(), []interface{}{}, nextElements,
+		func(sequence []interface{}) float64 { return 1 }, config); err == nil {
+		t.Error("Expected an error for DiscountFactor above 1")
+	}
+}
+
+func TestExportDOT(t *testing.T) {
+	root := &Node{sequence: []interface{}{}}
+	good := &Node{sequence: []interface{}{1}, parent: root}
+	bad := &Node{sequence: []interface{}{2}, parent: root}
+	rare := &Node{sequence: []interface{}{3}, parent: root}
+	deep := &Node{sequence: []interface{}{1, 4}, parent: good}
+	root.children = []*Node{good, bad, rare}
+	good.children = []*Node{deep}
+	for i := 0; i < 3; i++ {
+		backpropagate(deep, 1)
+		backpropagate(bad, 8)
+	}
+	backpropagate(rare, 5)
+
+	export := func(config ExportConfig) string {
+		var b strings.Builder
+		if err := ExportDOT(root, &b, config); err != nil {
+			t.Fatalf("ExportDOT failed: %v", err)
+		}
+		return b.String()
+	}
+
+	search := Config{
+		ExplorationConstant: 0.1,
+		SequenceToString:    func(sequence []interface{}) string { return fmt.Sprintf("move \"%v\"", sequence[0]) },
+	}
+	dot := export(ExportConfig{Search: search})
+	for _, expected := range []string{
+		"digraph mcts {",
+		`n0 [label="visits 7\nmean 4.571"];`,
+		`[label="move \"1\"\nvisits 3\nmean 1"];`,
+		`[label="move \"4\"\nvisits 3\nmean 1"];`,
+		"n0 -> n1 [penwidth=2.71];", // 3 of the 7 visits of the root
+		"n1 -> n2 [penwidth=5.00];",
+	} {
+		if !strings.Contains(dot, expected) {
+			t.Errorf("Expected %s in the export, got:\n%s", expected, dot)
+		}
+	}
+	if edges := strings.Count(dot, "->"); edges != 4 {
+		t.Errorf("Expected 4 edges, got %d:\n%s", edges, dot)
+	}
+
+	dot = export(ExportConfig{MaxDepth: 1, MinVisits: 2})
+	if strings.Contains(dot, "visits 1\n") || strings.Count(dot, "->") != 2 {
+		t.Errorf("Expected only the first level without the rare move, got:\n%s", dot)
+	}
+
+	dot = export(ExportConfig{ColorByUCT: true, Search: search})
+	if !strings.Contains(dot, `mean 1", style=filled, fillcolor="0.333 0.5 1.0"];`) ||
+		!strings.Contains(dot, `mean 8", style=filled, fillcolor="0.000 0.5 1.0"];`) {
+		t.Errorf("Expected the best move in green and the worst in red, got:\n%s", dot)
+	}
+
+	colored := export(ExportConfig{ColorByUCT: true, Search: Config{ExplorationConstant: defaultExplorationConstant}})
+	if dot := export(ExportConfig{ColorByUCT: true}); dot != colored {
+		t.Errorf("Expected an ExplorationConstant of 0 to color like the default, got:\n%s\ninstead of:\n%s", dot, colored)
+	}
+
+	// A transposition reached from root but last backpropagated through another parent
+	rare.parent = &Node{sequence: []interface{}{4}, visits: 1000, children: []*Node{rare}}
+	if dot := export(ExportConfig{ColorByUCT: true, Search: Config{ExplorationConstant: defaultExplorationConstant}}); dot != colored {
+		t.Errorf("Expected a shared node colored among its siblings in the export, got:\n%s\ninstead of:\n%s", dot, colored)
+	}
+}
+
+func TestExplorationDecay(t *testing.T) {
+	config := Config{ExplorationConstant: 2, ExplorationDecay: 0.5, MinExplorationConstant: 0.3}
+	for i, expected := range []float64{2, 1, 0.5, 0.3, 0.3} {
+		if got := decayedExploration(&config, i); got != expected {
+			t.Errorf("Iteration %d: expected exploration %v, got %v", i, expected, got)
+		}
+	}
+
+	config.ExplorationDecay = 0
+	if got := decayedExploration(&config, 10); got != 2 {
+		t.Errorf("Expected a fixed exploration constant without decay, got %v", got)
+	}
+
+	problem := &TestProblem{targetSum: 15, allowedDigits: []int{1, 2, 3, 4, 5}, maxLength: 4}
+	config = Config{MaxIterations: 10, TargetSeqLength: 4, ExplorationDecay: 1.5}
+	if _, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config); err == nil {
+		t.Error("Expected an error for ExplorationDecay above 1")
+	}
+
+	config.ExplorationDecay = 0.99
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil || result.Iterations != 10 {
+		t.Errorf("Expected a decayed search to run, got %v", err)
+	}
+}
+
+func TestRootParallel(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     30,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     10,
+	}
+	config := Config{
+		ExplorationConstant: 200,
+		MaxIterations:       2000,
+		TargetSeqLength:     10,
+		RandomSeed:          7,
+		Parallelism:         4,
+		RootParallel:        true,
+	}
+
+	run := func() *Result {
+		result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		return result
+	}
+
+	first := run()
+	if first.Iterations != config.MaxIterations {
+		t.Errorf("Expected %d iterations over all workers, got %d", config.MaxIterations, first.Iterations)
+	}
+	if len(first.Root.children) == 0 {
+		t.Fatal("Expected the merged root to have children")
+	}
+	childVisits := 0
+	for _, child := range first.Root.children {
+		childVisits += child.visits
+	}
+	if childVisits != first.Root.visits {
+		t.Errorf("Expected merged children visits to sum to the root visits, got %d vs %d", childVisits, first.Root.visits)
+	}
+
+	for attempt := 0; attempt < 5; attempt++ {
+		again := run()
+		if fmt.Sprint(again.BestSequence) != fmt.Sprint(first.BestSequence) || again.BestFitness != first.BestFitness {
+			t.Fatalf("Expected identical results for the same seed, got %v (%v) and %v (%v)",
+				first.BestSequence, first.BestFitness, again.BestSequence, again.BestFitness)
+		}
+		for i, child := range again.Root.children {
+			if expected := first.Root.children[i]; child.visits != expected.visits || child.sequence[0] != expected.sequence[0] {
+				t.Fatalf("Expected identical merged root children, got move %v with %d visits instead of move %v with %d",
+					child.sequence[0], child.visits, expected.sequence[0], expected.visits)
+			}
+		}
+	}
+
+	config.ReuseTree = first.Root
+	if _, err := RunDetailed(context.Background(), nil, problem.nextElements, problem.fitness, config); err == nil {
+		t.Error("Expected an error when continuing a ReuseTree in parallel")
+	}
+}
+
+func TestMergeTrees(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     20,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     6,
+	}
+	config := Config{
+		ExplorationConstant: 200,
+		MaxIterations:       2000,
+		TargetSeqLength:     6,
+		RandomSeed:          7,
+		Parallelism:         4,
+		RootParallel:        true,
+		MergeTrees:          true,
+	}
+
+	sequence, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if fitness := problem.fitness(sequence); fitness != 0 {
+		t.Errorf("Expected an exact solution, got %v (fitness %f)", sequence, fitness)
+	}
+	again, _ := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+	if fmt.Sprint(again) != fmt.Sprint(sequence) {
+		t.Errorf("Expected identical results for the same seed, got %v and %v", sequence, again)
+	}
+
+	// The merged tree keeps every level, each node holding the visits of its
+	// children plus the rollouts that started from it, at most one per worker
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if result.Iterations != config.MaxIterations || result.TreeDepth < 2 || result.TotalNodes != countNodes(result.Root) {
+		t.Errorf("Expected a deep merged tree after %d iterations, got %d iterations, depth %d and %d nodes",
+			config.MaxIterations, result.Iterations, result.TreeDepth, result.TotalNodes)
+	}
+	Walk(result.Root, func(node *Node) {
+		childVisits := 0
+		for _, child := range node.children {
+			childVisits += child.visits
+			if containsMove(node.unusedMoves, child.sequence[len(child.sequence)-1]) {
+				t.Errorf("Expected the expanded move %v not to be unused", child.sequence)
+			}
+		}
+		if childVisits > node.visits || (len(node.children) > 0 && node.visits-childVisits > config.Parallelism) {
+			t.Errorf("Expected %v with %d visits to have about as many below it, got %d", node.sequence, node.visits, childVisits)
+		}
+	})
+}
+
+func TestDepthExploration(t *testing.T) {
+	// The well known move scores better, the rarely tried one has the
+	// larger exploration bonus
+	root := &Node{sequence: []interface{}{}}
+	known := &Node{sequence: []interface{}{1}, parent: root}
+	rare := &Node{sequence: []interface{}{2}, parent: root}
+	root.children = []*Node{known, rare}
+	for i := 0; i < 20; i++ {
+		backpropagate(known, 1)
+	}
+	backpropagate(rare, 2)
+
+	tests := []struct {
+		name        string
+		exploration float64
+		depths      []float64
+		expected    *Node
+	}{
+		{"Without DepthExploration", 0.01, nil, known},
+		{"Root depth explores more", 0.01, []float64{10}, rare},
+		{"Root depth explores less", 10, []float64{0.01, 10}, known},
+		{"Too short for the root", 10, []float64{}, rare},
+	}
+	for _, tt := range tests {
+		config := Config{TargetSeqLength: 1, DepthExploration: tt.depths}
+		if selected := selection(root, tt.exploration, config, math.MaxFloat64, nil, nil); selected != tt.expected {
+			t.Errorf("%s: expected move %v, got %v", tt.name, tt.expected.sequence, selected.sequence)
+		}
+	}
+}
+
+func TestVirtualLossStress(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     30,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     8,
+	}
+	config := Config{
+		ExplorationConstant: 200,
+		MaxIterations:       20000,
+		TargetSeqLength:     problem.maxLength,
+		RandomSeed:          1,
+		Parallelism:         32,
+		VirtualLoss:         1000,
+	}
+
+	root, result, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if result.Iterations != config.MaxIterations {
+		t.Errorf("Expected %d iterations, got %d", config.MaxIterations, result.Iterations)
+	}
+
+	// Every node but the root had one rollout of its own when it was
+	// expanded, all others went through its children. Complete nodes are
+	// terminal, evaluated again whenever selection reaches them.
+	Walk(root, func(node *Node) {
+		if vl := atomic.LoadInt32(&node.virtualLoss); vl != 0 {
+			t.Errorf("Node %v still carries virtual loss %d", node.sequence, vl)
+		}
+		if len(node.sequence) == problem.maxLength {
+			return
+		}
+		expected := 1
+		if node == root {
+			expected = 0
+		}
+		total := 0.0
+		for _, child := range node.children {
+			expected += child.visits
+			total += child.totalFitness
+		}
+		if node.visits != expected {
+			t.Errorf("Node %v has %d visits, expected %d", node.sequence, node.visits, expected)
+		}
+		if node == root && math.Abs(node.totalFitness-total) > 1e-6*math.Max(1, total) {
+			t.Errorf("Root total fitness %v does not match its children's %v", node.totalFitness, total)
+		}
+	})
+
+	config.VirtualLoss = -1
+	if _, _, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config); err == nil {
+		t.Error("Expected an error for a negative VirtualLoss")
+	}
+}
+
+func TestMinVisitsBeforeUCT(t *testing.T) {
+	// The first move looks clearly better after more rollouts
+	root := &Node{sequence: []interface{}{}}
+	strong := &Node{sequence: []interface{}{1}, parent: root}
+	weak := &Node{sequence: []interface{}{2}, parent: root}
+	weaker := &Node{sequence: []interface{}{3}, parent: root}
+	root.children = []*Node{strong, weak, weaker}
+	for i := 0; i < 5; i++ {
+		backpropagate(strong, 1)
+	}
+	for i := 0; i < 2; i++ {
+		backpropagate(weak, 10)
+	}
+	backpropagate(weaker, 20)
+
+	tests := []struct {
+		minVisits int
+		expected  *Node
+	}{
+		{0, strong},
+		{1, strong},
+		{2, weaker}, // The only child below two visits
+		{3, weaker}, // Fewest visits first
+		{6, weaker},
+	}
+	for _, tt := range tests {
+		config := Config{TargetSeqLength: 1, MinVisitsBeforeUCT: tt.minVisits}
+		if selected := selection(root, 0.1, config, math.MaxFloat64, nil, nil); selected != tt.expected {
+			t.Errorf("MinVisitsBeforeUCT %d: expected move %v, got %v", tt.minVisits, tt.expected.sequence, selected.sequence)
+		}
+	}
+
+	backpropagate(weaker, 20)
+	backpropagate(weaker, 20)
+	config := Config{TargetSeqLength: 1, MinVisitsBeforeUCT: 3}
+	if selected := selection(root, 0.1, config, math.MaxFloat64, nil, nil); selected != weak {
+		t.Errorf("Expected the remaining child below three visits, got %v", selected.sequence)
+	}
+}
+
+func TestNormalizeRewards(t *testing.T) {
+	// The same statistics at two fitness scales: the well known move looks
+	// slightly better, the rarely tried one has the larger exploration bonus
+	selectAtScale := func(scale float64, normalize bool) interface{} {
+		root := &Node{sequence: []interface{}{}}
+		known := &Node{sequence: []interface{}{1}, parent: root}
+		rare := &Node{sequence: []interface{}{2}, parent: root}
+		root.children = []*Node{known, rare}
+		for i := 0; i < 5; i++ {
+			backpropagate(known, 0)
+			backpropagate(known, 2*scale)
+		}
+		backpropagate(rare, 1*scale)
+		backpropagate(rare, 2*scale)
+
+		config := Config{TargetSeqLength: 1}
+		if normalize {
+			config.rewardBounds = newRewardBounds()
+			config.rewardBounds.observe(0)
+			config.rewardBounds.observe(2 * scale)
+		}
+		return selection(root, 1.41, config, math.MaxFloat64, nil, nil).sequence[0]
+	}
+
+	if small, large := selectAtScale(1, false), selectAtScale(10000, false); small == large {
+		t.Errorf("Expected the raw fitness scale to change the selected move, got %v at both scales", small)
+	}
+	if small, large := selectAtScale(1, true), selectAtScale(10000, true); small != 2 || large != 2 {
+		t.Errorf("Expected the rarely tried move at both scales with NormalizeRewards, got %v and %v", small, large)
+	}
+
+	bounds := newRewardBounds()
+	bounds.observe(-10000)
+	bounds.observe(math.MaxFloat64)
+	bounds.observe(10000)
+	for value, expected := range map[float64]float64{-10000: 0, 0: 0.5, 10000: 1, math.MaxFloat64: 1, math.Inf(-1): 0} {
+		if got := bounds.normalize(value); got != expected {
+			t.Errorf("Expected %v to be normalized to %v, got %v", value, expected, got)
+		}
+	}
+
+	// One exploration constant for squared errors and tic-tac-toe scores
+	t.Run("Sum", func(t *testing.T) {
+		problem := &TestProblem{targetSum: 30, allowedDigits: []int{1, 2, 3, 4, 5}, maxLength: 8}
+		config := Config{
+			ExplorationConstant:    1.41,
+			MaxIterations:          1000,
+			TargetSeqLength:        problem.maxLength,
+			RandomSeed:             1,
+			GuaranteeFullExpansion: true,
+			NormalizeRewards:       true,
+		}
+		result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		if result.BestFitness != 0 {
+			t.Errorf("Expected an exact solution, got %v (fitness %v)", result.BestSequence, result.BestFitness)
+		}
+		if result.Root.visits != config.MaxIterations {
+			t.Errorf("Expected the search to keep exploring for all %d iterations, root has %d visits", config.MaxIterations, result.Root.visits)
+		}
+	})
+
+	t.Run("TicTacToe", func(t *testing.T) {
+		problem := &TicTacToeProblem{
+			initialState: &TicTacToeState{
+				board: [9]int{
+					1, 1, 0,
+					0, 2, 0,
+					0, 0, 0,
+				},
+				nextMove: 2,
+				moves:    []int{},
+			},
+			player: 2,
+		}
+		// Offer every empty cell at the root instead of only the forced block
+		allMoves := func(sequence []interface{}) []interface{} {
+			if len(sequence) > 0 {
+				return problem.nextElements(sequence)
+			}
+			return []interface{}{2, 3, 5, 6, 7, 8}
+		}
+		config := Config{
+			ExplorationConstant:    1.41,
+			MaxIterations:          1000,
+			TargetSeqLength:        -1,
+			GuaranteeFullExpansion: true,
+			NormalizeRewards:       true,
+			IsSequenceTerminated: func(sequence []interface{}) bool {
+				return len(allMoves(sequence)) == 0
+			},
+		}
+		for seed := int64(0); seed < 20; seed++ {
+			config.RandomSeed = seed
+			result, err := RunDetailed(context.Background(), []interface{}{}, allMoves, problem.fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed: %v", err)
+			}
+			if move := mostVisitedChild(result.Root).sequence[0]; move != 2 {
+				t.Errorf("Seed %d: expected blocking move 2 to be the most visited, got %v", seed, move)
+			}
+		}
+	})
+}
+
+func TestFinalSelectionCriteria(t *testing.T) {
+	// Most visits with the worst mean, best mean with the fewest visits, a
+	// runner-up on both counts and a move weak on both
+	root := &Node{sequence: []interface{}{}}
+	popular := &Node{sequence: []interface{}{1}, parent: root}
+	promising := &Node{sequence: []interface{}{2}, parent: root}
+	balanced := &Node{sequence: []interface{}{3}, parent: root}
+	weak := &Node{sequence: []interface{}{4}, parent: root}
+	root.children = []*Node{popular, promising, balanced, weak}
+	for i := 0; i < 10; i++ {
+		backpropagate(popular, 10)
+	}
+	backpropagate(promising, 1)
+	for i := 0; i < 8; i++ {
+		backpropagate(balanced, 2)
+	}
+	backpropagate(weak, 9)
+	backpropagate(weak, 9)
+
+	tests := []struct {
+		criteria string
+		expected *Node
+	}{
+		{FinalSelectionMostVisits, popular},
+		{FinalSelectionBestFitness, promising},
+		{FinalSelectionMixed, balanced}, // Second by visits and by mean, the only rank sum of 2
+	}
+	for _, tt := range tests {
+		if selected := selectBestChild(root, tt.criteria, &Config{}); selected != tt.expected {
+			t.Errorf("%s: expected move %v, got %v", tt.criteria, tt.expected.sequence, selected.sequence)
+		}
+	}
+	if selected := selectBestChild(popular, FinalSelectionMostVisits, &Config{}); selected != nil {
+		t.Errorf("Expected no child below a leaf, got %v", selected.sequence)
+	}
+
+	problem := &TestProblem{targetSum: 30, allowedDigits: []int{1, 2, 3, 4, 5}, maxLength: 8}
+	config := Config{
+		ExplorationConstant:    200,
+		MaxIterations:          1000,
+		TargetSeqLength:        problem.maxLength,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		FinalSelectionCriteria: FinalSelectionMostVisits,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if len(result.BestSequence) != problem.maxLength || result.BestFitness != problem.fitness(result.BestSequence) {
+		t.Errorf("Expected a complete sequence with its fitness, got %v (fitness %v)", result.BestSequence, result.BestFitness)
+	}
+	for node := mostVisitedChild(result.Root); node != nil; node = mostVisitedChild(node) {
+		if !isPrefix(node.sequence, result.BestSequence) {
+			t.Fatalf("Expected %v to follow the most visited path through %v", result.BestSequence, node.sequence)
+		}
+	}
+
+	config.FinalSelectionCriteria = "robust"
+	if _, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config); err == nil {
+		t.Error("Expected an error for an unknown FinalSelectionCriteria")
+	}
+}
+
+func TestTemperature(t *testing.T) {
+	root := &Node{sequence: []interface{}{}}
+	for move, visits := range []int{10, 30, 60, 0} {
+		child := &Node{sequence: []interface{}{move}, parent: root, visits: visits}
+		root.children = append(root.children, child)
+	}
+
+	// Share of draws going to each child at temperature 1 and close to 0
+	shares := func(temperature float64) []float64 {
+		counts := make([]float64, len(root.children))
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 10000; i++ {
+			child := sampleByVisits(root, temperature, rng)
+			counts[child.sequence[0].(int)]++
+		}
+		for i := range counts {
+			counts[i] /= 10000
+		}
+		return counts
+	}
+	for i, share := range shares(1) {
+		expected := float64(root.children[i].visits) / 100
+		if math.Abs(share-expected) > 0.02 {
+			t.Errorf("Temperature 1: expected child %d drawn %.2f of the time, got %.2f", i, expected, share)
+		}
+	}
+	if cold := shares(0.01); cold[2] != 1 {
+		t.Errorf("Expected a temperature near 0 to always draw the most visited child, got %v", cold)
+	}
+
+	problem := &TestProblem{targetSum: 20, allowedDigits: []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, maxLength: 4}
+	config := Config{
+		ExplorationConstant: 50,
+		MaxIterations:       300,
+		TargetSeqLength:     problem.maxLength,
+		Temperature:         1,
+	}
+	firstMoves := make(map[interface{}]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		config.RandomSeed = seed
+		result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		if len(result.BestSequence) != problem.maxLength || result.BestFitness != problem.fitness(result.BestSequence) {
+			t.Errorf("Expected a complete sequence with its fitness, got %v (fitness %v)", result.BestSequence, result.BestFitness)
+		}
+		firstMoves[result.BestSequence[0]] = true
+	}
+	t.Logf("Temperature 1 played %d different first moves over 20 seeds", len(firstMoves))
+	if len(firstMoves) < 2 {
+		t.Errorf("Expected sampling to vary the first move, got %v", firstMoves)
+	}
+
+	config.Temperature = -1
+	if _, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config); err == nil {
+		t.Error("Expected an error for a negative Temperature")
+	}
+}
+
+func TestFirstPlayUrgency(t *testing.T) {
+	// Fifty first moves of which five are good, followed by a long tail of
+	// moves that do not matter
+	nextElements := func(sequence []interface{}) []interface{} {
+		if len(sequence) == 0 {
+			moves := make([]interface{}, 50)
+			for i := range moves {
+				moves[i] = i
+			}
+			return moves
+		}
+		return []interface{}{0, 1}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		if sequence[0].(int) < 5 {
+			return 0
+		}
+		return 1
+	}
+
+	run := func(config Config) *Node {
+		config.ExplorationConstant = 0.1
+		config.MaxIterations = 200
+		config.TargetSeqLength = 30
+		config.RandomSeed = 1
+		result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		return result.Root
+	}
+
+	if root := run(Config{GuaranteeFullExpansion: true}); len(root.children) != 50 {
+		t.Errorf("Expected every first move to be tried without first play urgency, got %d", len(root.children))
+	}
+
+	root := run(Config{UseFirstPlayUrgency: true, FirstPlayUrgency: 0.5})
+	best := mostVisitedChild(root)
+	t.Logf("%d of 50 first moves tried, move %v has %d of %d visits", len(root.children), best.sequence[0], best.visits, root.visits)
+	if len(root.children) >= 25 {
+		t.Errorf("Expected most first moves to be skipped, %d were tried", len(root.children))
+	}
+	if best.sequence[0].(int) >= 5 || best.visits*2 < root.visits {
+		t.Errorf("Expected visits to concentrate on a good move, got move %v with %d of %d visits", best.sequence[0], best.visits, root.visits)
+	}
+
+	// Unvisited children, only seen while a parallel simulation is in
+	// flight, are scored at the urgency
+	child := &Node{sequence: []interface{}{1}, parent: root}
+	if uct := calculateUCT(child, 1, &Config{UseFirstPlayUrgency: true, FirstPlayUrgency: 0.25}); uct != 0.25 {
+		t.Errorf("Expected an unvisited child to score 0.25, got %v", uct)
+	}
+}
+
+func TestFPUReduction(t *testing.T) {
+	// The same fifty first moves as TestFirstPlayUrgency, of which five are good
+	nextElements := func(sequence []interface{}) []interface{} {
+		if len(sequence) == 0 {
+			moves := make([]interface{}, 50)
+			for i := range moves {
+				moves[i] = i
+			}
+			return moves
+		}
+		return []interface{}{0, 1}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		if sequence[0].(int) < 5 {
+			return 0
+		}
+		return 1
+	}
+
+	run := func(reduction float64) *Node {
+		result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, Config{
+			ExplorationConstant: 0.1,
+			MaxIterations:       200,
+			TargetSeqLength:     30,
+			RandomSeed:          1,
+			UseFirstPlayUrgency: true,
+			FPUReduction:        reduction,
+		})
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		return result.Root
+	}
+
+	// A child scores better than its parent's own value, so a pessimistic
+	// urgency never lets a second move be tried
+	if root := run(0.2); len(root.children) != 1 {
+		t.Errorf("Expected a single first move to be tried with a positive reduction, got %d", len(root.children))
+	}
+
+	root := run(-0.05)
+	best := mostVisitedChild(root)
+	t.Logf("%d of 50 first moves tried, move %v has %d of %d visits", len(root.children), best.sequence[0], best.visits, root.visits)
+	if len(root.children) >= 25 {
+		t.Errorf("Expected most first moves to be skipped, %d were tried", len(root.children))
+	}
+	if best.sequence[0].(int) >= 5 || best.visits*2 < root.visits {
+		t.Errorf("Expected visits to concentrate on a good move, got move %v with %d of %d visits", best.sequence[0], best.visits, root.visits)
+	}
+
+	// Untried moves are scored at the mean of their parent made worse by the
+	// reduction, which is added when minimizing and subtracted when maximizing
+	parent := &Node{visits: 4, totalFitness: 2}
+	child := &Node{sequence: []interface{}{1}, parent: parent}
+	config := &Config{UseFirstPlayUrgency: true, FirstPlayUrgency: 10, FPUReduction: 0.25}
+	if uct := calculateUCT(child, 1, config); uct != 0.75 {
+		t.Errorf("Expected an unvisited child to score 0.75, got %v", uct)
+	}
+	config.Maximize = true
+	if uct := calculateUCT(child, 1, config); uct != 0.25 {
+		t.Errorf("Expected an unvisited child to score 0.25 when maximizing, got %v", uct)
+	}
+}
+
+func TestMinSeqLength(t *testing.T) {
+	// Sums of digits close to 18, every move costing 1: best with four moves
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3, 4, 5}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		diff := float64(sequenceSum(sequence) - 18)
+		return diff*diff + float64(len(sequence))
+	}
+
+	var lengths []int
+	config := Config{
+		ExplorationConstant:    200,
+		MaxIterations:          2000,
+		MinSeqLength:           3,
+		TargetSeqLength:        6,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		TopK:                   3,
+	}
+	config.OnProgress = func(stats ProgressStats) {
+		if len(stats.BestSequence) > 0 {
+			lengths = append(lengths, len(stats.BestSequence))
+		}
+	}
+	config.ProgressInterval = 500
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if len(result.BestSequence) != 4 || result.BestFitness != 4 {
+		t.Errorf("Expected four moves summing to 18, got %v (fitness %v)", result.BestSequence, result.BestFitness)
+	}
+	if result.Iterations != config.MaxIterations {
+		t.Errorf("Expected %d iterations over all lengths, got %d", config.MaxIterations, result.Iterations)
+	}
+	if result.Root.visits <= config.MaxIterations/4 {
+		t.Errorf("Expected the tree to be kept across lengths, root has %d visits", result.Root.visits)
+	}
+	if len(lengths) != 4 || lengths[0] < 3 || lengths[3] != 6 {
+		t.Errorf("Expected one quarter of the budget at each length from 3 to 6, best sequence lengths were %v", lengths)
+	}
+	if len(result.TopSequences) != 3 || result.TopSequences[0].Fitness != 4 {
+		t.Errorf("Expected the top sequences over all lengths, got %v", result.TopSequences)
+	}
+
+	config.MinSeqLength = 7
+	if _, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config); err == nil {
+		t.Error("Expected an error for MinSeqLength above TargetSeqLength")
+	}
+}
+
+func TestRunAsync(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       2000,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+	}
+
+	var results []Result
+	for result := range RunAsync(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config) {
+		results = append(results, result)
+		time.Sleep(time.Millisecond) // A slow reader only sees the latest pending result
+	}
+	if len(results) == 0 {
+		t.Fatal("Expected at least one result before the channel was closed")
+	}
+	// The final result is sent even when it does not improve
+	last := results[len(results)-1]
+	for i := 1; i < len(results); i++ {
+		improved := results[i].BestFitness < results[i-1].BestFitness
+		if !improved && (i < len(results)-1 || results[i].BestFitness != results[i-1].BestFitness) {
+			t.Errorf("Expected strictly improving results, got %v after %v", results[i].BestFitness, results[i-1].BestFitness)
+		}
+	}
+	if last.Root == nil || last.Err != nil {
+		t.Errorf("Expected the final result to carry the tree and no error, got root %v and error %v", last.Root, last.Err)
+	}
+	detailed, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if last.BestFitness != detailed.BestFitness || fmt.Sprint(last.BestSequence) != fmt.Sprint(detailed.BestSequence) {
+		t.Errorf("Expected the last result to match RunDetailed %v, got %v", detailed.BestSequence, last.BestSequence)
+	}
+
+	// Cancellation closes the channel
+	ctx, cancel := context.WithCancel(context.Background())
+	config.MaxIterations = 0
+	config.MaxDuration = time.Hour
+	stream := RunAsync(ctx, []interface{}{}, problem.nextElements, problem.fitness, config)
+	if _, ok := <-stream; !ok {
+		t.Fatal("Expected a result before cancellation")
+	}
+	cancel()
+	var final Result
+	for result := range stream {
+		final = result
+	}
+	if !errors.Is(final.Err, context.Canceled) || final.Root == nil {
+		t.Errorf("Expected the final result to carry the tree and the cancellation, got root %v and error %v", final.Root, final.Err)
+	}
+
+	config.MaxDuration = 0 // Invalid, no budget
+	results = nil
+	for result := range RunAsync(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config) {
+		results = append(results, result)
+	}
+	if len(results) != 1 || results[0].Err == nil {
+		t.Errorf("Expected a single result carrying the configuration error, got %v", results)
+	}
+}
+
+func TestPrincipalVariation(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       1000,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	pv := result.PrincipalVariation
+	if len(pv) == 0 || fmt.Sprint(pv) != fmt.Sprint(PrincipalVariation(result.Root)) {
+		t.Fatalf("Expected Result.PrincipalVariation to match the tree, got %v", pv)
+	}
+
+	// Every move must lead to the most visited child of the node before it
+	node := result.Root
+	for i, move := range pv {
+		var next *Node
+		for _, child := range node.children {
+			if child.sequence[len(child.sequence)-1] == move {
+				next = child
+			}
+		}
+		if next == nil {
+			t.Fatalf("Move %d (%v) of %v is not a child in the tree", i, move, pv)
+		}
+		for _, child := range node.children {
+			if child.visits > next.visits {
+				t.Errorf("Move %d (%v) has %d visits, but %v has %d", i, move, next.visits, child.sequence, child.visits)
+			}
+		}
+		node = next
+	}
+	if len(node.children) != 0 {
+		t.Errorf("Expected the principal variation to end at a leaf, %v has children", node.sequence)
+	}
+
+	if pv := PrincipalVariation(&Node{}); len(pv) != 0 {
+		t.Errorf("Expected no moves below a leaf, got %v", pv)
+	}
+}
+
+func TestNodeDepth(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     5,
+	}
+
+	var reported []ProgressStats
+	config := Config{
+		ExplorationConstant: 2.0,
+		MaxIterations:       600,
+		TargetSeqLength:     5,
+		RandomSeed:          1,
+	}
+	var root *Node
+	config.OnProgress = func(stats ProgressStats) {
+		reported = append(reported, stats)
+		if stats.TreeDepth != getTreeDepth(root) {
+			t.Errorf("Iteration %d: expected tree depth %d, got %d", stats.Iterations, getTreeDepth(root), stats.TreeDepth)
+		}
+	}
+	root = &Node{sequence: []interface{}{1}}
+	config.ReuseTree = root
+
+	result, err := RunDetailed(context.Background(), nil, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if len(reported) != 6 {
+		t.Errorf("Expected 6 progress reports, got %d", len(reported))
+	}
+	Walk(result.Root, func(node *Node) {
+		if node.depth != len(node.sequence)-1 {
+			t.Errorf("Expected %v at depth %d, got %d", node.sequence, len(node.sequence)-1, node.depth)
+		}
+	})
+
+	// Depths stay relative to the new root after advancing it
+	advanced, err := AdvanceRoot(result.Root, PrincipalVariation(result.Root)[0])
+	if err != nil {
+		t.Fatalf("AdvanceRoot failed: %v", err)
+	}
+	root = advanced
+	config.ReuseTree = advanced
+	reported = nil
+	if _, err := RunDetailed(context.Background(), nil, problem.nextElements, problem.fitness, config); err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if len(reported) == 0 || reported[len(reported)-1].TreeDepth > 3 {
+		t.Errorf("Expected at most 3 levels below the advanced root, got %v", reported)
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	valid := Config{MaxIterations: 10, TargetSeqLength: 4}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, got %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		modify   func(config *Config)
+		expected error
+	}{
+		{"NoBudget", func(config *Config) { config.MaxIterations = 0 }, ErrNoBudget},
+		{"NegativeIterations", func(config *Config) { config.MaxIterations = -1 }, ErrNoBudget},
+		{"NegativeTargetSeqLength", func(config *Config) { config.TargetSeqLength = -2 }, ErrInvalidTargetSeqLength},
+		{"MinSeqLengthAboveTarget", func(config *Config) { config.MinSeqLength = 5 }, ErrInvalidTargetSeqLength},
+		{"MissingTermination", func(config *Config) { config.TargetSeqLength = -1 }, ErrMissingTermination},
+		{"NegativeExploration", func(config *Config) { config.ExplorationConstant = -1 }, ErrInvalidExplorationConstant},
+		{"BatchWithComponents", func(config *Config) {
+			config.BatchFitness = func(sequences [][]interface{}) []float64 { return make([]float64, len(sequences)) }
+			config.FitnessComponents = []FitnessFunc{func([]interface{}) float64 { return 0 }}
+			config.FitnessWeights = []float64{1}
+		}, ErrIncompatibleOptions},
+		{"FitnessResultWithIncremental", func(config *Config) {
+			config.FitnessResultFunc = func([]interface{}) FitnessResult { return FitnessResult{} }
+			config.IncrementalFitness = func(fitness float64, sequence []interface{}, move interface{}) float64 { return 0 }
+		}, ErrIncompatibleOptions},
+		{"RootParallelMinSeqLength", func(config *Config) {
+			config.RootParallel, config.Parallelism, config.MinSeqLength = true, 2, 2
+		}, ErrIncompatibleOptions},
+		{"TranspositionsWithoutStateKey", func(config *Config) { config.Transpositions = true }, ErrMissingOption},
+		{"ChanceWithoutOutcome", func(config *Config) {
+			config.IsChanceNode = func([]interface{}) bool { return false }
+		}, ErrMissingOption},
+		{"UnknownUCTVariant", func(config *Config) { config.UCTVariant = "ucb2" }, ErrInvalidOption},
+		{"NegativeVirtualLoss", func(config *Config) { config.VirtualLoss = -1 }, ErrInvalidOption},
+		{"DiscountFactorAboveOne", func(config *Config) { config.DiscountFactor = 2 }, ErrInvalidOption},
+		{"UnknownBackupStrategy", func(config *Config) { config.BackupStrategy = "median" }, ErrInvalidOption},
+		{"FitnessWeightsMismatch", func(config *Config) {
+			config.FitnessComponents = []FitnessFunc{func([]interface{}) float64 { return 0 }}
+		}, ErrInvalidOption},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.modify(&config)
+			err := config.Validate()
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, err)
+			}
+			for _, other := range tests {
+				if other.expected != tt.expected && errors.Is(err, other.expected) {
+					t.Errorf("Error %v also matches %v", err, other.expected)
+				}
+			}
+
+			result, runErr := RunDetailed(context.Background(), []interface{}{}, func([]interface{}) []interface{} { return []interface{}{1} },
+				func([]interface{}) float64 { return 0 }, config)
+			if result != nil || !errors.Is(runErr, tt.expected) {
+				t.Errorf("Expected RunDetailed to fail with %v, got %v", tt.expected, runErr)
+			}
+		})
+	}
+}
+
+func TestMaxDepth(t *testing.T) {
+	// Termination is rare: only sums of exactly 40
+	problem := &TestProblem{
+		targetSum:     40,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     100,
+	}
+	var longest int
+	fitness := func(sequence []interface{}) float64 {
+		if len(sequence) > longest {
+			longest = len(sequence)
+		}
+		diff := float64(sequenceSum(sequence) - problem.targetSum)
+		return diff * diff
+	}
+	config := Config{
+		ExplorationConstant:    2000,
+		MaxIterations:          1000,
+		TargetSeqLength:        -1,
+		IsSequenceTerminated:   func(sequence []interface{}) bool { return sequenceSum(sequence) == 40 },
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		MaxDepth:               3,
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{1}, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed with error: %v", err)
+	}
+	if result.TreeDepth != config.MaxDepth {
+		t.Errorf("Expected the tree to stop at depth %d, got %d", config.MaxDepth, result.TreeDepth)
+	}
+	if longest != 4 {
+		t.Errorf("Expected rollouts to stop 3 moves below the initial sequence, longest had %d moves", longest)
+	}
+	if fmt.Sprint(result.BestSequence) != "[1 5 5 5]" {
+		t.Errorf("Expected the best sequence at the horizon [1 5 5 5], got %v", result.BestSequence)
+	}
+
+	// Horizon nodes are evaluated again instead of being expanded, so every
+	// iteration that did not add a node ended at one
+	visits, horizon := 0, 0
+	Walk(result.Root, func(node *Node) {
+		if len(node.sequence) == 4 {
+			visits += node.visits - 1
+			horizon++
+			if len(node.children) > 0 {
+				t.Errorf("Expected no children below %v", node.sequence)
+			}
+		}
+	})
+	if expected := config.MaxIterations - (result.TotalNodes - 1); visits != expected || horizon == 0 {
+		t.Errorf("Expected %d evaluations of existing horizon nodes, got %d", expected, visits)
+	}
+
+	config.MaxDepth = -1
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an error for a negative MaxDepth")
+	}
+}
+
+func TestChanceNodes(t *testing.T) {
+	// "gamble" is settled by a fair coin: heads costs 0, tails 10, an
+	// expected 5. "safe" always costs 4, worse than heads but a better bet.
+	nextElements := func(sequence []interface{}) []interface{} {
+		switch {
+		case len(sequence) == 0:
+			return []interface{}{"gamble", "safe"}
+		case sequence[0] == "gamble":
+			return []interface{}{"heads", "tails"}
+		default:
+			return []interface{}{"done"}
+		}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		switch sequence[len(sequence)-1] {
+		case "heads":
+			return 0
+		case "tails":
+			return 10
+		}
+		return 4
+	}
+	config := Config{
+		ExplorationConstant:    5,
+		MaxIterations:          2000,
+		TargetSeqLength:        2,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		IsChanceNode: func(sequence []interface{}) bool {
+			return len(sequence) == 1 && sequence[0] == "gamble"
+		},
+		ChanceOutcome: func(sequence []interface{}, rng *rand.Rand) interface{} {
+			if rng.Intn(2) == 0 {
+				return "heads"
+			}
+			return "tails"
+		},
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if pv := result.PrincipalVariation; len(pv) == 0 || pv[0] != "safe" {
+		t.Errorf("Expected the safe move to be preferred over the gamble, got %v", pv)
+	}
+
+	var gamble *Node
+	for _, child := range result.Root.children {
+		if child.sequence[0] == "gamble" {
+			gamble = child
+		}
+	}
+	if gamble == nil || !gamble.chance || gamble.visits < 20 {
+		t.Fatalf("Expected the gamble to be a visited chance node, got %+v", gamble)
+	}
+	if mean := gamble.MeanFitness(); math.Abs(mean-5) > 1.5 {
+		t.Errorf("Expected the gamble to average close to 5, got %v", mean)
+	}
+	// Both outcomes are sampled rather than the lucky one being exploited
+	for _, outcome := range gamble.children {
+		if share := float64(outcome.visits) / float64(gamble.visits); share < 0.3 {
+			t.Errorf("Outcome %v got only %.0f%% of the gamble's visits", outcome.sequence, share*100)
+		}
+	}
+
+	config.ChanceOutcome = nil
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an error for IsChanceNode without ChanceOutcome")
+	}
+}
+
+func TestTabuFunc(t *testing.T) {
+	// Tours of five cities, revisiting one is tabu
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3, 4, 5}
+	}
+	revisits := func(sequence []interface{}) bool {
+		return containsMove(sequence[:len(sequence)-1], sequence[len(sequence)-1])
+	}
+	evaluated := 0
+	fitness := func(sequence []interface{}) float64 {
+		evaluated++
+		for i := 1; i < len(sequence); i++ {
+			if revisits(sequence[:i+1]) {
+				t.Fatalf("Rollout %v revisits a city", sequence)
+			}
+		}
+		return float64(sequenceSum(sequence))
+	}
+	config := Config{
+		MaxIterations:          300,
+		TargetSeqLength:        5,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		TabuFunc:               revisits,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if evaluated == 0 || len(result.BestSequence) != 5 {
+		t.Errorf("Expected a complete tour, got %v", result.BestSequence)
+	}
+	Walk(result.Root, func(node *Node) {
+		if len(node.sequence) > 0 && revisits(node.sequence) {
+			t.Errorf("Expected no tabu node in the tree, got %v", node.sequence)
+		}
+	})
+
+	t.Run("Backtracking", func(t *testing.T) {
+		// Every third move is tabu after a second move of 1, so rollouts
+		// have to back up and play 2 instead
+		config := Config{
+			TargetSeqLength: 3,
+			TabuFunc: func(sequence []interface{}) bool {
+				return len(sequence) == 3 && sequence[1] == 1
+			},
+		}
+		binary := func(sequence []interface{}) []interface{} { return []interface{}{1, 2} }
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 50; i++ {
+			sequence := simulation(&Node{}, binary, config, rng)
+			if len(sequence) != 3 || sequence[1] != 2 {
+				t.Fatalf("Expected a complete rollout with a second move of 2, got %v", sequence)
+			}
+		}
+
+		// Moves the rollout started from are never undone
+		if sequence := simulation(&Node{sequence: []interface{}{1, 1}}, binary, config, rng); len(sequence) != 2 {
+			t.Errorf("Expected the rollout to stop short, got %v", sequence)
+		}
+	})
+}
+
+func TestBatchFitness(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     6,
+	}
+
+	largest, calls, evaluated := 0, 0, 0
+	config := Config{
+		ExplorationConstant:    2.0,
+		MaxIterations:          1000,
+		TargetSeqLength:        6,
+		RandomSeed:             1,
+		GuaranteeFullExpansion: true,
+		BatchSize:              8,
+		BatchFitness: func(sequences [][]interface{}) []float64 {
+			calls++
+			evaluated += len(sequences)
+			if len(sequences) > largest {
+				largest = len(sequences)
+			}
+			fitness := make([]float64, len(sequences))
+			for j, sequence := range sequences {
+				fitness[j] = problem.fitness(sequence)
+			}
+			return fitness
+		},
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, nil, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if largest != config.BatchSize {
+		t.Errorf("Expected batches of %d sequences, the largest had %d", config.BatchSize, largest)
+	}
+	if evaluated < result.TotalNodes-1 || calls >= evaluated {
+		t.Errorf("Expected a rollout per expanded node evaluated in batches, got %d for %d nodes in %d calls",
+			evaluated, result.TotalNodes-1, calls)
+	}
+	if result.BestFitness != problem.fitness(result.BestSequence) || result.BestFitness > 1 {
+		t.Errorf("Expected a sequence summing to about 15, got %v (fitness %v)", result.BestSequence, result.BestFitness)
+	}
+	Walk(result.Root, func(node *Node) {
+		if vl := atomic.LoadInt32(&node.virtualLoss); vl != 0 {
+			t.Errorf("Node %v still carries virtual loss %d", node.sequence, vl)
+		}
+	})
+
+	// Cached sequences are not passed on to the batch
+	uncached, nodes := evaluated, result.TotalNodes
+	evaluated = 0
+	config.EnableMemoization = true
+	result, err = RunDetailed(context.Background(), []interface{}{}, problem.nextElements, nil, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if evaluated > uncached || result.TotalNodes != nodes {
+		t.Errorf("Expected the same search with at most %d sequences evaluated, got %d", uncached, evaluated)
+	}
+
+	// A batch with a missing value is skipped instead of crashing the search
+	calls = 0
+	config.EnableMemoization = false
+	config.BatchFitness = func(sequences [][]interface{}) []float64 {
+		calls++
+		fitness := make([]float64, len(sequences))
+		for j, sequence := range sequences {
+			fitness[j] = problem.fitness(sequence)
+		}
+		if calls%2 == 0 {
+			return fitness[1:]
+		}
+		return fitness
+	}
+	result, err = RunDetailed(context.Background(), []interface{}{}, problem.nextElements, nil, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if result.FitnessErrors == 0 || result.FitnessErrors >= result.Iterations {
+		t.Errorf("Expected every other batch to be skipped, got %d skipped rollouts", result.FitnessErrors)
+	}
+	Walk(result.Root, func(node *Node) {
+		if vl := atomic.LoadInt32(&node.virtualLoss); vl != 0 {
+			t.Errorf("Node %v still carries virtual loss %d", node.sequence, vl)
+		}
+	})
+
+	// With some sequences cached, a batch returning one value per sequence
+	// of the whole batch still has the wrong count
+	memo := newFitnessMemo(nil)
+	memo.values.Store(fmt.Sprint([]interface{}{1}), 1.0)
+	oversized := memo.wrapBatch(func(sequences [][]interface{}) []float64 { return []float64{2, 3} })
+	if fitness := oversized([][]interface{}{{1}, {2}}); len(fitness) == 2 {
+		t.Errorf("Expected a batch with the wrong count to be reported, got %v", fitness)
+	}
+
+	empty := func(sequences [][]interface{}) []float64 { return nil }
+	if fitness := singleFitness(empty, false)([]interface{}{1}); fitness != math.MaxFloat64 {
+		t.Errorf("Expected a missing value to score the worst fitness, got %v", fitness)
+	}
+}
+
+// BenchmarkTreeGrowth measures the allocations of a search spent mostly on
+// adding nodes, every iteration expanding a new one
+func BenchmarkTreeGrowth(b *testing.B) {
+	problem := &TestProblem{
+		targetSum:     40,
+		allowedDigits: []int{1, 2, 3, 4, 5, 6, 7, 8, 9},
+		maxLength:     8,
+	}
+	config := Config{
+		ExplorationConstant:    1.41,
+		MaxIterations:          20000,
+		TargetSeqLength:        8,
+		MaxSimulationDepth:     1,
+		GuaranteeFullExpansion: true,
+		RandomSeed:             1,
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config); err != nil {
+			b.Fatalf("MCTS failed: %v", err)
+		}
+	}
+}
+
+func TestNextElementsNotRecomputed(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	nextElements := func(sequence []interface{}) []interface{} {
+		mu.Lock()
+		calls[fmt.Sprint(sequence)]++
+		mu.Unlock()
+		return []interface{}{1, 2, 3}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		return math.Abs(float64(sequenceSum(sequence) - 7))
+	}
+
+	// Rollouts of a single move only generate the moves of the node they
+	// start from, which its expansion needs again later
+	config := Config{
+		ExplorationConstant:    1.41,
+		MaxIterations:          200,
+		TargetSeqLength:        4,
+		MaxSimulationDepth:     1,
+		GuaranteeFullExpansion: true,
+		RandomSeed:             1,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	expanded := 0
+	Walk(result.Root, func(node *Node) {
+		if len(node.sequence) >= config.TargetSeqLength || len(node.children) == 0 {
+			return
+		}
+		expanded++
+		if n := calls[fmt.Sprint(node.sequence)]; n != 1 {
+			t.Errorf("Expected the moves after %v to be generated once, got %d calls", node.sequence, n)
+		}
+	})
+	if expanded < 10 {
+		t.Fatalf("Expected a tree with expanded inner nodes, got %d", expanded)
+	}
+}
+
+func TestTreeStats(t *testing.T) {
+	// A root with two children, one of which has three children of its own
+	root := &Node{visits: 9}
+	a := &Node{sequence: []interface{}{1}, parent: root, visits: 5}
+	b := &Node{sequence: []interface{}{2}, parent: root, visits: 4}
+	root.children = []*Node{a, b}
+	for i := 0; i < 3; i++ {
+		a.children = append(a.children, &Node{sequence: []interface{}{1, i}, parent: a, visits: i})
+	}
+
+	stats := TreeStats(root)
+	if stats.TotalNodes != 6 || stats.LeafNodes != 4 || stats.MaxDepth != 2 || stats.Truncated {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.AvgBranching != 2.5 {
+		t.Errorf("Expected an average branching of 2.5, got %v", stats.AvgBranching)
+	}
+	// Visits 0, 1, 2, 4, 5 and 9 fall into buckets 0, 1, 2, 3, 3 and 4
+	if want := []int{1, 1, 1, 2, 1}; fmt.Sprint(stats.VisitHistogram) != fmt.Sprint(want) {
+		t.Errorf("Expected visit histogram %v, got %v", want, stats.VisitHistogram)
+	}
+
+	if stats := TreeStats(nil); stats.TotalNodes != 0 {
+		t.Errorf("Expected empty stats for a nil root, got %+v", stats)
+	}
+
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     5,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       500,
+		TargetSeqLength:     5,
+		RandomSeed:          1,
+	})
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	stats = TreeStats(result.Root)
+	if stats.TotalNodes != result.TotalNodes || stats.MaxDepth != result.TreeDepth {
+		t.Errorf("Expected %d nodes %d deep, got %+v", result.TotalNodes, result.TreeDepth, stats)
+	}
+	histogramTotal := 0
+	for _, count := range stats.VisitHistogram {
+		histogramTotal += count
+	}
+	if histogramTotal != stats.TotalNodes {
+		t.Errorf("Expected the histogram to count all %d nodes, got %d", stats.TotalNodes, histogramTotal)
+	}
+}
+
+func TestSelectionStopsAtUntriedMoves(t *testing.T) {
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		return math.Abs(float64(sequenceSum(sequence) - 8))
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       40,
+		TargetSeqLength:     5,
+		RandomSeed:          1,
+	})
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	if n := len(result.Root.children); n != 3 {
+		t.Errorf("Expected every move of the root to be tried, got %d children", n)
+	}
+	// A node has a grandchild only once selection descended past it, which
+	// must not happen while it still has untried moves
+	Walk(result.Root, func(node *Node) {
+		for _, child := range node.children {
+			if len(child.children) > 0 && len(node.unusedMoves) > 0 {
+				t.Errorf("Selection descended past %v with untried moves %v", node.sequence, node.unusedMoves)
+				return
+			}
+		}
+	})
+}
+
+func TestPruneThreshold(t *testing.T) {
+	// Sequences starting with 0 are hopeless, the others close to the
+	// target sum of 12
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{0, 1, 2, 3, 4}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		if sequence[0] == 0 {
+			return 100
+		}
+		return 1 + math.Abs(float64(sequenceSum(sequence)-12))
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       1000,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+		PruneThreshold:      2,
+		PruneInterval:       50,
+	})
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	if result.BestFitness != 1 {
+		t.Errorf("Expected an exact solution, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+	}
+	for _, child := range result.Root.children {
+		if child.sequence[0] == 0 {
+			t.Errorf("Expected the hopeless first move to be pruned, it has %d visits", child.visits)
+		}
+	}
+	if containsMove(result.Root.unusedMoves, 0) {
+		t.Errorf("Expected the hopeless first move not to be tried again")
+	}
+	// Every node left either has a recorded fitness within the threshold or
+	// is the last child kept below its parent
+	Walk(result.Root, func(node *Node) {
+		if node.parent != nil && node.visits > 0 && node.minFitness > 3 && len(node.parent.children) > 1 {
+			t.Errorf("Expected %v with best fitness %f to be pruned", node.sequence, node.minFitness)
+		}
+	})
+}
+
+func TestNodeInit(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     15,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+
+	var calls int32
+	config := Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       300,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+		NodeInit: func(node *Node, sequence []interface{}) {
+			atomic.AddInt32(&calls, 1)
+			node.Metadata = sequenceSum(sequence)
+		},
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	if int(calls) != result.TotalNodes-1 {
+		t.Errorf("Expected NodeInit to be called for each of the %d nodes below the root, got %d calls", result.TotalNodes-1, calls)
+	}
+	Walk(result.Root, func(node *Node) {
+		if node == result.Root {
+			if node.Metadata != nil {
+				t.Errorf("Expected no metadata on the root, got %v", node.Metadata)
+			}
+			return
+		}
+		if node.Metadata != sequenceSum(node.sequence) {
+			t.Errorf("Expected metadata %d on %v, got %v", sequenceSum(node.sequence), node.sequence, node.Metadata)
+		}
+	})
+
+	shrunk := ShrinkTree(&Tree{Root: result.Root}, 10)
+	Walk(shrunk.Root, func(node *Node) {
+		if node != shrunk.Root && node.Metadata != sequenceSum(node.sequence) {
+			t.Errorf("Expected ShrinkTree to keep the metadata of %v, got %v", node.sequence, node.Metadata)
+		}
+	})
+}
+
+// weightedDigitSum scores a sequence of digits by the sum of each digit
+// times its position, replaying the whole sequence, with an incremental
+// counterpart that only adds the last digit
+func weightedDigitSum(sequence []interface{}) float64 {
+	total := 0.0
+	for i, move := range sequence {
+		total += float64(move.(int) * (i + 1))
+	}
+	return total
+}
+
+func weightedDigitSumStep(parentFitness float64, parentSeq []interface{}, move interface{}) float64 {
+	return parentFitness + float64(move.(int)*(len(parentSeq)+1))
+}
+
+func TestIncrementalFitness(t *testing.T) {
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3}
+	}
+
+	var mu sync.Mutex
+	fullCalls := 0
+	countedFitness := func(sequence []interface{}) float64 {
+		mu.Lock()
+		fullCalls++
+		mu.Unlock()
+		return weightedDigitSum(sequence)
+	}
+
+	run := func(config Config, fitness FitnessFunc) *Result {
+		config.ExplorationConstant = 1.41
+		config.MaxIterations = 300
+		config.TargetSeqLength = 10
+		config.RandomSeed = 1
+		result, err := RunDetailed(context.Background(), []interface{}{3}, nextElements, fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		return result
+	}
+
+	full := run(Config{}, weightedDigitSum)
+	incremental := run(Config{IncrementalFitness: weightedDigitSumStep}, countedFitness)
+
+	if fmt.Sprint(full.BestSequence) != fmt.Sprint(incremental.BestSequence) || full.BestFitness != incremental.BestFitness {
+		t.Errorf("Expected the same result as the full fitness, got %v (%f) instead of %v (%f)",
+			incremental.BestSequence, incremental.BestFitness, full.BestSequence, full.BestFitness)
+	}
+	if full.Root.Visits() != incremental.Root.Visits() || full.Root.MeanFitness() != incremental.Root.MeanFitness() {
+		t.Errorf("Expected the same root statistics, got %d visits with mean %f instead of %d with mean %f",
+			incremental.Root.Visits(), incremental.Root.MeanFitness(), full.Root.Visits(), full.Root.MeanFitness())
+	}
+	// The fitness function is only called for the root
+	if fullCalls != 1 {
+		t.Errorf("Expected the full fitness function to be called once, got %d calls", fullCalls)
+	}
+}
+
+func BenchmarkIncrementalFitness(b *testing.B) {
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3, 4, 5, 6, 7, 8, 9}
+	}
+	config := Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       2000,
+		TargetSeqLength:     200,
+		RandomSeed:          1,
+	}
+
+	// Replays the sequence into a fresh state on every call, as game
+	// fitness functions typically do
+	replayed := func(sequence []interface{}) float64 {
+		counts := make(map[int]int)
+		for _, move := range sequence {
+			counts[move.(int)]++
+		}
+		return weightedDigitSum(sequence)
+	}
+
+	b.Run("Full", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := Run([]interface{}{}, nextElements, replayed, config); err != nil {
+				b.Fatalf("MCTS failed: %v", err)
+			}
+		}
+	})
+	b.Run("Incremental", func(b *testing.B) {
+		config := config
+		config.IncrementalFitness = weightedDigitSumStep
+		for i := 0; i < b.N; i++ {
+			if _, err := Run([]interface{}{}, nextElements, replayed, config); err != nil {
+				b.Fatalf("MCTS failed: %v", err)
+			}
+		}
+	})
+}
+
+func TestSliceMoves(t *testing.T) {
+	// Moves are single-digit slices, which == cannot compare
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{[]int{1}, []int{2}, []int{3}, []int{4}, []int{5}}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		sum := 0
+		for _, move := range sequence {
+			sum += move.([]int)[0]
+		}
+		return math.Abs(float64(sum - 15))
+	}
+
+	for name, config := range map[string]Config{
+		"MostVisits":     {FinalSelectionCriteria: FinalSelectionMostVisits},
+		"PruneThreshold": {PruneThreshold: 0.5, PruneInterval: 10},
+		"PUCT":           {UCTVariant: UCTVariantPUCT},
+		"TabuFunc":       {TabuFunc: func(sequence []interface{}) bool { return len(sequence) == 1 && sequence[0].([]int)[0] == 1 }},
+		"RolloutPolicy":  {RolloutPolicy: func(sequence []interface{}, moves []interface{}) interface{} { return []int{5} }},
+		"MergeTrees":     {Parallelism: 2, RootParallel: true, MergeTrees: true},
+	} {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			config.MaxIterations = 500
+			config.TargetSeqLength = 4
+			config.RandomSeed = 1
+			config.GuaranteeFullExpansion = true
+
+			sequence, err := Run([]interface{}{}, nextElements, fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed with error: %v", err)
+			}
+			if len(sequence) != 4 {
+				t.Errorf("Expected a sequence of 4 moves, got %v", sequence)
+			}
+		})
+	}
+}
+
+func TestMoveWeightFunc(t *testing.T) {
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3, 4, 5}
+	}
+	weight := func(sequence []interface{}, move interface{}) float64 {
+		switch move {
+		case 1:
+			return 1
+		case 3:
+			return 3
+		case 4:
+			return -1
+		case 5:
+			return math.NaN()
+		}
+		return 0
+	}
+	config := Config{TargetSeqLength: 20, MoveWeightFunc: weight}
+	rng := rand.New(rand.NewSource(1))
+
+	counts := make(map[interface{}]int)
+	for i := 0; i < 200; i++ {
+		for _, move := range simulation(&Node{}, nextElements, config, rng) {
+			counts[move]++
+		}
+	}
+	for _, move := range []int{2, 4, 5} {
+		if counts[move] != 0 {
+			t.Errorf("Expected moves of weight 0, negative or NaN never to be played, move %d was played %d times", move, counts[move])
+		}
+	}
+	if ratio := float64(counts[3]) / float64(counts[1]); ratio < 2.7 || ratio > 3.3 {
+		t.Errorf("Expected move 3 about three times as often as move 1, got %d and %d", counts[3], counts[1])
+	}
+
+	// Without a positive weight moves are drawn uniformly
+	config.MoveWeightFunc = func(sequence []interface{}, move interface{}) float64 { return 0 }
+	counts = make(map[interface{}]int)
+	for _, move := range simulation(&Node{}, nextElements, config, rng) {
+		counts[move]++
+	}
+	if len(counts) != 5 {
+		t.Errorf("Expected every move to be played with zero weights, got %v", counts)
+	}
+}
+
+func TestFitnessResultFunc(t *testing.T) {
+	problem := &TestProblem{
+		targetSum:     12,
+		allowedDigits: []int{1, 2, 3, 4, 5},
+		maxLength:     4,
+	}
+	// Sequences starting with 5 cannot be evaluated, although they would
+	// reach the target most easily
+	errUnavailable := errors.New("evaluation unavailable")
+	fitness := func(sequence []interface{}) FitnessResult {
+		if len(sequence) > 0 && sequence[0] == 5 {
+			return FitnessResult{Err: errUnavailable}
+		}
+		return FitnessResult{Value: problem.fitness(sequence)}
+	}
+
+	result, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, nil, Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       500,
+		TargetSeqLength:     4,
+		RandomSeed:          1,
+		FitnessResultFunc:   fitness,
+	})
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	if result.BestSequence[0] == 5 || result.BestFitness != 0 {
+		t.Errorf("Expected an exact solution that can be evaluated, got %v (fitness %f)", result.BestSequence, result.BestFitness)
+	}
+	if result.FitnessErrors == 0 {
+		t.Error("Expected the failed evaluations to be counted")
+	}
+	// The first move whose rollout failed is dropped for good
+	Walk(result.Root, func(node *Node) {
+		if len(node.sequence) > 0 && node.sequence[0] == 5 {
+			t.Errorf("Expected no node below the failing move, found %v", node.sequence)
+		}
+	})
+	if containsMove(result.Root.unusedMoves, 5) {
+		t.Error("Expected the failing move not to be tried again")
+	}
+
+	if _, err := RunDetailed(context.Background(), []interface{}{}, problem.nextElements, nil, Config{
+		MaxIterations:      10,
+		TargetSeqLength:    4,
+		FitnessResultFunc:  fitness,
+		IncrementalFitness: weightedDigitSumStep,
+	}); err == nil {
+		t.Error("Expected FitnessResultFunc to be rejected with IncrementalFitness")
+	}
+}
+
+func TestSelectFunc(t *testing.T) {
+	nextElements := func(sequence []interface{}) []interface{} {
+		return []interface{}{1, 2, 3}
+	}
+	fitness := func(sequence []interface{}) float64 {
+		return math.Abs(float64(sequenceSum(sequence) - 8))
+	}
+
+	calls := 0
+	first := func(parent *Node, children []*Node, explorationConstant float64) *Node {
+		calls++
+		if parent.Visits() < len(children) || children[0].Variance() < 0 {
+			t.Errorf("Unexpected statistics for %v", parent.Sequence())
+		}
+		return children[0]
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       100,
+		TargetSeqLength:     5,
+		RandomSeed:          1,
+		SelectFunc:          first,
+	})
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	if calls == 0 {
+		t.Fatal("Expected SelectFunc to be called")
+	}
+	// Selection only ever descends into the first child, the others keep
+	// the single visit of their expansion
+	Walk(result.Root, func(node *Node) {
+		if len(node.children) < 2 {
+			return
+		}
+		for _, child := range node.children[1:] {
+			if child.visits != 1 {
+				t.Errorf("Expected %v to be visited once, got %d visits", child.sequence, child.visits)
+			}
+		}
+	})
+
+	t.Run("Stop at a fully expanded node", func(t *testing.T) {
+		stop := func(parent *Node, children []*Node, explorationConstant float64) *Node {
+			return nil
+		}
+		result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, Config{
+			MaxIterations:   200,
+			TargetSeqLength: 5,
+			RandomSeed:      1,
+			SelectFunc:      stop,
+		})
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+
+		// Only the root is ever expanded, once per move
+		if children := len(result.Root.children); children != 3 {
+			t.Errorf("Expected 3 root children, got %d", children)
+		}
+		if result.TotalNodes != 4 {
+			t.Errorf("Expected 4 nodes, got %d", result.TotalNodes)
+		}
+	})
+}
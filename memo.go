@@ -0,0 +1,95 @@
+package mcts
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// fitnessMemo caches fitness values by sequence key so that sequences
+// rolled out more than once are only evaluated once, safe for use by
+// parallel workers
+type fitnessMemo struct {
+	values  sync.Map // Fitness by key
+	key     func(sequence []interface{}) string
+	lookups int64 // Accessed atomically
+	hits    int64 // Accessed atomically
+}
+
+// newFitnessMemo returns an empty cache keyed by key, or by fmt.Sprint of
+// the sequence when key is nil
+func newFitnessMemo(key func(sequence []interface{}) string) *fitnessMemo {
+	if key == nil {
+		key = func(sequence []interface{}) string { return fmt.Sprint(sequence) }
+	}
+	return &fitnessMemo{key: key}
+}
+
+// wrap returns a FitnessFunc answering from the cache for sequences already
+// evaluated and calling fitnessFunc otherwise
+func (m *fitnessMemo) wrap(fitnessFunc FitnessFunc) FitnessFunc {
+	return func(sequence []interface{}) float64 {
+		key, value, ok := m.lookup(sequence)
+		if ok {
+			return value
+		}
+		fitness := fitnessFunc(sequence)
+		m.values.Store(key, fitness)
+		return fitness
+	}
+}
+
+// lookup returns the key of sequence and its cached fitness, if any
+func (m *fitnessMemo) lookup(sequence []interface{}) (string, float64, bool) {
+	atomic.AddInt64(&m.lookups, 1)
+	key := m.key(sequence)
+	if value, ok := m.values.Load(key); ok {
+		atomic.AddInt64(&m.hits, 1)
+		return key, value.(float64), true
+	}
+	return key, 0, false
+}
+
+// hitRate returns the share of lookups answered from the cache
+func (m *fitnessMemo) hitRate() float64 {
+	lookups := atomic.LoadInt64(&m.lookups)
+	if lookups == 0 {
+		return 0
+	}
+	return float64(atomic.LoadInt64(&m.hits)) / float64(lookups)
+}
+
+// wrapBatch is wrap for a BatchFitnessFunc, passing only the sequences
+// missing from the cache on to batch
+func (m *fitnessMemo) wrapBatch(batch BatchFitnessFunc) BatchFitnessFunc {
+	return func(sequences [][]interface{}) []float64 {
+		fitness := make([]float64, len(sequences))
+		keys := make([]string, len(sequences))
+		var missing [][]interface{}
+		var missingIndex []int
+		for j, sequence := range sequences {
+			atomic.AddInt64(&m.lookups, 1)
+			keys[j] = m.key(sequence)
+			if value, ok := m.values.Load(keys[j]); ok {
+				atomic.AddInt64(&m.hits, 1)
+				fitness[j] = value.(float64)
+				continue
+			}
+			missing = append(missing, sequence)
+			missingIndex = append(missingIndex, j)
+		}
+		if len(missing) == 0 {
+			return fitness
+		}
+
+		evaluated := batch(missing)
+		if len(evaluated) != len(missing) {
+			return nil // Never matches the caller's count, so the mismatch is reported
+		}
+		for k, j := range missingIndex {
+			fitness[j] = evaluated[k]
+			m.values.Store(keys[j], evaluated[k])
+		}
+		return fitness
+	}
+}
@@ -0,0 +1,54 @@
+package mcts
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// rewardBounds tracks the lowest and highest fitness backpropagated during
+// a search with NormalizeRewards. Values are stored as math.Float64bits so
+// selection can read them without taking the search lock; they are only
+// written under it.
+type rewardBounds struct {
+	low  uint64
+	high uint64
+}
+
+func newRewardBounds() *rewardBounds {
+	return &rewardBounds{
+		low:  math.Float64bits(math.Inf(1)),
+		high: math.Float64bits(math.Inf(-1)),
+	}
+}
+
+// observe widens the bounds to fitness, ignoring infinities and
+// math.MaxFloat64 sentinels so they do not swamp the range
+func (b *rewardBounds) observe(fitness float64) {
+	if math.IsNaN(fitness) || math.Abs(fitness) >= math.MaxFloat64 {
+		return
+	}
+	if fitness < math.Float64frombits(atomic.LoadUint64(&b.low)) {
+		atomic.StoreUint64(&b.low, math.Float64bits(fitness))
+	}
+	if fitness > math.Float64frombits(atomic.LoadUint64(&b.high)) {
+		atomic.StoreUint64(&b.high, math.Float64bits(fitness))
+	}
+}
+
+// normalize rescales value to [0,1] within the bounds, clamping values
+// outside of them, sentinels included, to the nearest end. Before the
+// bounds span a range, values are 0, 0.5 or 1 depending on how they
+// compare to the single fitness observed.
+func (b *rewardBounds) normalize(value float64) float64 {
+	low := math.Float64frombits(atomic.LoadUint64(&b.low))
+	high := math.Float64frombits(atomic.LoadUint64(&b.high))
+	switch {
+	case value <= low && value < high:
+		return 0
+	case value >= high && value > low:
+		return 1
+	case high <= low:
+		return 0.5
+	}
+	return (value - low) / (high - low)
+}
@@ -0,0 +1,315 @@
+package mcts
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RunPartitioned executes MCTS with the first moves split deterministically
+// across workers. Worker w owns every root move whose index modulo workers
+// is w, searches only below those moves with seed config.RandomSeed + w and
+// its share of config.MaxIterations. The best sequence over all workers is
+// returned, with ties going to the lowest worker index, so the result only
+// depends on the seed and not on goroutine scheduling.
+func RunPartitioned(
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+	workers int,
+) ([]interface{}, error) {
+	rootMoves := nextElements(initialSequence)
+	if workers > len(rootMoves) {
+		workers = len(rootMoves)
+	}
+	if config.MaxIterations > 0 && workers > config.MaxIterations {
+		workers = config.MaxIterations
+	}
+	if workers <= 1 {
+		return Run(initialSequence, nextElements, fitnessFunc, config)
+	}
+
+	results := make([]*Result, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		var owned []interface{}
+		for i := w; i < len(rootMoves); i += workers {
+			owned = append(owned, rootMoves[i])
+		}
+
+		workerConfig := config
+		workerConfig.RandomSeed = config.RandomSeed + int64(w)
+		workerConfig.MaxIterations = config.MaxIterations / workers
+		if w < config.MaxIterations%workers {
+			workerConfig.MaxIterations++
+		}
+
+		wg.Add(1)
+		go func(w int, owned []interface{}, workerConfig Config) {
+			defer wg.Done()
+
+			// Restrict the root to the moves this worker owns
+			workerNextElements := func(sequence []interface{}) []interface{} {
+				if len(sequence) == len(initialSequence) {
+					moves := make([]interface{}, len(owned))
+					copy(moves, owned)
+					return moves
+				}
+				return nextElements(sequence)
+			}
+
+			_, results[w], errs[w] = search(context.Background(), initialSequence, workerNextElements, fitnessFunc, workerConfig)
+		}(w, owned, workerConfig)
+	}
+	wg.Wait()
+
+	var best *Result
+	for w := 0; w < workers; w++ {
+		if errs[w] != nil {
+			return nil, errs[w]
+		}
+		if best == nil || isBetter(config.Maximize, results[w].BestFitness, best.BestFitness) {
+			best = results[w]
+		}
+	}
+
+	return best.BestSequence, nil
+}
+
+// searchRootParallel runs config.Parallelism independent searches from
+// initialSequence, worker w seeded with config.RandomSeed + w, or with the
+// w-th value drawn from config.Rand when it is set, and with its share of
+// config.MaxIterations. The root children of the trees are merged by move,
+// summing their statistics, and the best sequence is the best one found
+// below the most visited merged child. Under config.MergeTrees the whole
+// trees are merged depth-first instead, and the best sequence follows
+// config.FinalSelectionCriteria down the merged tree. Workers share no state, so the
+// result only depends on the seed and not on goroutine scheduling.
+func searchRootParallel(
+	ctx context.Context,
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) (*Node, *Result, error) {
+	workers := config.Parallelism
+	startTime := time.Now()
+
+	results := make([]*Result, workers)
+	errs := make([]error, workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		workerConfig := config
+		workerConfig.Parallelism = 1
+		workerConfig.RootParallel = false
+		workerConfig.Rand = nil
+		workerConfig.Temperature = 0 // Sampled once from the merged root
+		workerConfig.RandomSeed = config.RandomSeed + int64(w)
+		if config.Rand != nil {
+			workerConfig.RandomSeed = config.Rand.Int63()
+		}
+		workerConfig.MaxIterations = config.MaxIterations / workers
+		if w < config.MaxIterations%workers {
+			workerConfig.MaxIterations++
+		}
+		if config.MaxIterations > 0 && workerConfig.MaxIterations == 0 {
+			continue // Fewer iterations than workers
+		}
+
+		wg.Add(1)
+		go func(w int, workerConfig Config) {
+			defer wg.Done()
+			_, results[w], errs[w] = search(ctx, initialSequence, nextElements, fitnessFunc, workerConfig)
+		}(w, workerConfig)
+	}
+	wg.Wait()
+
+	var ctxErr error
+	for w := 0; w < workers; w++ {
+		if errs[w] != nil && results[w] == nil {
+			return nil, nil, errs[w] // Invalid configuration
+		}
+		if errs[w] != nil && ctxErr == nil {
+			ctxErr = errs[w]
+		}
+	}
+
+	root := &Node{sequence: initialSequence}
+	result := &Result{Root: root}
+	var topK *topSequences
+	if config.TopK > 0 {
+		topK = newTopSequences(config.TopK, config)
+	}
+	for _, workerResult := range results {
+		if workerResult == nil {
+			continue
+		}
+		if config.MergeTrees {
+			mergeTree(root, workerResult.Root)
+		} else {
+			mergeRootChildren(root, workerResult.Root)
+		}
+		result.Iterations += workerResult.Iterations
+		result.FitnessErrors += workerResult.FitnessErrors
+		result.TotalNodes += workerResult.TotalNodes
+		if workerResult.TreeDepth > result.TreeDepth {
+			result.TreeDepth = workerResult.TreeDepth
+		}
+		if topK != nil {
+			for _, top := range workerResult.TopSequences {
+				topK.add(top.Sequence, top.Fitness)
+			}
+		}
+	}
+
+	// Prefer the best sequence below the most visited move, or the move
+	// sampled under Temperature, ties going to the lowest worker index
+	var chosen interface{}
+	chosenChild := mostVisitedChild(root)
+	if config.Temperature > 0 && !config.MergeTrees {
+		chosenChild = sampleByVisits(root, config.Temperature, finalRand(config))
+	}
+	if chosenChild != nil {
+		chosen = chosenChild.sequence[len(initialSequence)]
+	}
+	var best, bestBelowChosen *Result
+	for _, workerResult := range results {
+		if workerResult == nil {
+			continue
+		}
+		if best == nil || isBetter(config.Maximize, workerResult.BestFitness, best.BestFitness) {
+			best = workerResult
+		}
+		below := len(workerResult.BestSequence) > len(initialSequence) && sameMove(workerResult.BestSequence[len(initialSequence)], chosen)
+		if below && (bestBelowChosen == nil || isBetter(config.Maximize, workerResult.BestFitness, bestBelowChosen.BestFitness)) {
+			bestBelowChosen = workerResult
+		}
+	}
+	if bestBelowChosen != nil {
+		best = bestBelowChosen
+	}
+
+	result.BestSequence = best.BestSequence
+	result.BestFitness = best.BestFitness
+	result.Components = best.Components
+	if config.MergeTrees {
+		dropExpandedMoves(root)
+		result.TreeDepth = getTreeDepth(root)
+		result.TotalNodes = countNodes(root)
+
+		// Follow the combined statistics down the merged tree
+		if config.FinalSelectionCriteria == "" {
+			config.FinalSelectionCriteria = FinalSelectionMostVisits
+		}
+		result.BestSequence, result.BestFitness = finalSequence(root, best.BestSequence, best.BestFitness,
+			searchMoves(nextElements, config), searchFitness(fitnessFunc, config), config)
+		result.Components = nil
+		for _, component := range config.FitnessComponents {
+			result.Components = append(result.Components, component(result.BestSequence))
+		}
+	}
+	result.PrincipalVariation = PrincipalVariation(root)
+	if topK != nil {
+		result.TopSequences = topK.sorted()
+	}
+	result.Elapsed = time.Since(startTime)
+	return root, result, ctxErr
+}
+
+// mergeRootChildren adds the statistics of the root and root children of
+// tree to merged, matching children by their last move. Merged children
+// keep no subtrees.
+func mergeRootChildren(merged, tree *Node) {
+	mergeStats(merged, tree)
+	for _, child := range tree.childrenSnapshot() {
+		move := child.sequence[len(child.sequence)-1]
+		var target *Node
+		for _, existing := range merged.children {
+			if sameMove(existing.sequence[len(existing.sequence)-1], move) {
+				target = existing
+				break
+			}
+		}
+		if target == nil {
+			target = &Node{sequence: child.sequence, parent: merged, depth: merged.depth + 1, Metadata: child.Metadata}
+			merged.children = append(merged.children, target)
+		}
+		mergeStats(target, child)
+	}
+}
+
+// mergeTree joins tree into merged depth-first, summing the statistics of
+// nodes reached by the same moves and adding the ones merged lacks. The
+// unused moves of all trees are gathered, see dropExpandedMoves.
+func mergeTree(merged, tree *Node) {
+	mergeStats(merged, tree)
+
+	tree.mu.Lock()
+	for _, move := range tree.unusedMoves {
+		if !containsMove(merged.unusedMoves, move) {
+			merged.unusedMoves = append(merged.unusedMoves, move)
+		}
+	}
+	tree.mu.Unlock()
+
+	for _, child := range tree.childrenSnapshot() {
+		move := child.sequence[len(child.sequence)-1]
+		var target *Node
+		for _, existing := range merged.children {
+			if sameMove(existing.sequence[len(existing.sequence)-1], move) {
+				target = existing
+				break
+			}
+		}
+		if target == nil {
+			target = &Node{sequence: child.sequence, parent: merged, depth: merged.depth + 1, chance: child.chance, Metadata: child.Metadata}
+			merged.children = append(merged.children, target)
+		}
+		mergeTree(target, child)
+	}
+}
+
+// dropExpandedMoves removes from the unused moves of every node of a merged
+// tree the moves another tree expanded
+func dropExpandedMoves(node *Node) {
+	var unused []interface{}
+	for _, move := range node.unusedMoves {
+		expanded := false
+		for _, child := range node.children {
+			if sameMove(child.sequence[len(child.sequence)-1], move) {
+				expanded = true
+				break
+			}
+		}
+		if !expanded {
+			unused = append(unused, move)
+		}
+	}
+	node.unusedMoves = unused
+	for _, child := range node.children {
+		dropExpandedMoves(child)
+	}
+}
+
+// mergeStats adds the visits and fitness statistics of node to merged
+func mergeStats(merged, node *Node) {
+	node.mu.Lock()
+	defer node.mu.Unlock()
+	if node.visits == 0 {
+		return
+	}
+	if merged.visits == 0 || node.minFitness < merged.minFitness {
+		merged.minFitness = node.minFitness
+	}
+	if merged.visits == 0 || node.maxFitness > merged.maxFitness {
+		merged.maxFitness = node.maxFitness
+	}
+	merged.visits += node.visits
+	merged.totalFitness += node.totalFitness
+	merged.sumSquaredFitness += node.sumSquaredFitness
+	merged.lastFitness = node.lastFitness
+}
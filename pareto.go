@@ -0,0 +1,191 @@
+package mcts
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// MultiFitnessFunc evaluates several objectives of a sequence at once, all
+// of them minimized
+type MultiFitnessFunc func(sequence []interface{}) []float64
+
+// ParetoSolution is a sequence that no other sequence found beats on every
+// objective
+type ParetoSolution struct {
+	Sequence   []interface{}
+	Objectives []float64
+}
+
+// RunMultiObjective searches for the Pareto front of fitnessFunc, the
+// sequences that are not dominated by any other sequence found. Each rollout
+// is valued by how much it grows the hypervolume dominated by the front, so
+// selection favours branches that keep extending it. The reference point of
+// the hypervolume is one past the worst value seen for each objective. The
+// front is returned ordered by its first objective.
+func RunMultiObjective(
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc MultiFitnessFunc,
+	config Config,
+) ([]ParetoSolution, error) {
+	if config.Maximize {
+		return nil, fmt.Errorf("RunMultiObjective minimizes every objective, Maximize is not supported")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	front := &paretoFront{}
+	var errOnce sync.Once
+	var frontErr error
+	scalar := func(sequence []interface{}) float64 {
+		if !isSequenceComplete(sequence, config) {
+			return 0
+		}
+		gain, err := front.add(sequence, fitnessFunc(sequence))
+		if err != nil {
+			errOnce.Do(func() {
+				frontErr = err
+				cancel()
+			})
+		}
+		return -gain
+	}
+
+	_, _, err := search(ctx, initialSequence, nextElements, scalar, config)
+	if frontErr != nil {
+		return nil, frontErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(front.solutions, func(i, j int) bool {
+		return front.solutions[i].Objectives[0] < front.solutions[j].Objectives[0]
+	})
+	return front.solutions, nil
+}
+
+// paretoFront is the set of non-dominated solutions found so far, shared by
+// all workers of a search
+type paretoFront struct {
+	mu        sync.Mutex
+	solutions []ParetoSolution
+	worst     []float64 // Highest value seen for each objective
+}
+
+// add offers a solution to the front and returns the hypervolume it adds,
+// 0 when it is dominated by or equal to a solution already on the front.
+// Every solution must have as many objectives as the first one.
+func (f *paretoFront) add(sequence []interface{}, objectives []float64) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.worst == nil {
+		if len(objectives) == 0 {
+			return 0, fmt.Errorf("MultiFitnessFunc returned no objectives for %v", sequence)
+		}
+		f.worst = append([]float64(nil), objectives...)
+	}
+	if len(objectives) != len(f.worst) {
+		return 0, fmt.Errorf("MultiFitnessFunc returned %d objectives for %v, expected %d", len(objectives), sequence, len(f.worst))
+	}
+	for i, value := range objectives {
+		f.worst[i] = math.Max(f.worst[i], value)
+	}
+
+	points := make([][]float64, 0, len(f.solutions)+1)
+	for _, solution := range f.solutions {
+		if dominates(solution.Objectives, objectives) || equalObjectives(solution.Objectives, objectives) {
+			return 0, nil
+		}
+		points = append(points, solution.Objectives)
+	}
+
+	// Solutions the new one dominates still count before it is added
+	reference := make([]float64, len(f.worst))
+	for i, value := range f.worst {
+		reference[i] = value + 1
+	}
+	before := hypervolume(points, reference)
+	after := hypervolume(append(points, objectives), reference)
+
+	kept := f.solutions[:0]
+	for _, solution := range f.solutions {
+		if !dominates(objectives, solution.Objectives) {
+			kept = append(kept, solution)
+		}
+	}
+	solution := ParetoSolution{
+		Sequence:   append([]interface{}(nil), sequence...),
+		Objectives: append([]float64(nil), objectives...),
+	}
+	f.solutions = append(kept, solution)
+
+	return after - before, nil
+}
+
+// dominates reports whether a is at least as good as b on every objective
+// and strictly better on one
+func dominates(a, b []float64) bool {
+	better := false
+	for i := range a {
+		if a[i] > b[i] {
+			return false
+		}
+		if a[i] < b[i] {
+			better = true
+		}
+	}
+	return better
+}
+
+func equalObjectives(a, b []float64) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// hypervolume returns the volume dominated by points and bounded by
+// reference, slicing along the last objective and recursing on the rest
+func hypervolume(points [][]float64, reference []float64) float64 {
+	dims := len(reference)
+	if len(points) == 0 || dims == 0 {
+		return 0
+	}
+	if dims == 1 {
+		best := reference[0]
+		for _, point := range points {
+			best = math.Min(best, point[0])
+		}
+		return reference[0] - best
+	}
+
+	sorted := make([][]float64, 0, len(points))
+	for _, point := range points {
+		if point[dims-1] < reference[dims-1] {
+			sorted = append(sorted, point)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i][dims-1] < sorted[j][dims-1]
+	})
+
+	volume := 0.0
+	for i, point := range sorted {
+		upper := reference[dims-1]
+		if i+1 < len(sorted) {
+			upper = sorted[i+1][dims-1]
+		}
+		if height := upper - point[dims-1]; height > 0 {
+			volume += height * hypervolume(sorted[:i+1], reference[:dims-1])
+		}
+	}
+	return volume
+}
@@ -0,0 +1,267 @@
+package mcts
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// defaultPruneInterval is used when PruneThreshold is set without a
+// PruneInterval
+const defaultPruneInterval = 100
+
+// PrunePolicy chooses the subtrees removed once a search tree holds more
+// than Config.MaxNodes nodes. SelectPrune is called repeatedly until the tree
+// is back within the limit and returns a node below tree.Root whose whole
+// subtree is removed, or nil to stop pruning. bestSequence is the best
+// sequence found so far, nil if there is none yet.
+type PrunePolicy interface {
+	SelectPrune(tree *Tree, bestSequence []interface{}) *Node
+}
+
+// FewestVisitsPrune removes the subtree with the fewest visits that does not
+// lead towards the best sequence found so far. Subtrees are compared in
+// post-order, so on ties a leaf goes before its ancestors and earlier
+// children before later ones. It is the default PrunePolicy.
+type FewestVisitsPrune struct{}
+
+// SelectPrune returns the node below tree.Root with the fewest visits,
+// skipping the nodes on the path of bestSequence
+func (FewestVisitsPrune) SelectPrune(tree *Tree, bestSequence []interface{}) *Node {
+	var selected *Node
+	fewest := 0
+
+	visited := make(map[*Node]bool)
+	var visit func(node *Node)
+	visit = func(node *Node) {
+		if visited[node] {
+			return // Shared by transpositions, compared once
+		}
+		visited[node] = true
+		for _, child := range node.childrenSnapshot() {
+			visit(child)
+		}
+		if node == tree.Root || isPrefix(node.sequence, bestSequence) {
+			return
+		}
+		if visits := node.Visits(); selected == nil || visits < fewest {
+			selected, fewest = node, visits
+		}
+	}
+	visit(tree.Root)
+
+	return selected
+}
+
+// enforceMaxNodes prunes subtrees chosen by the configured PrunePolicy until
+// the tree holds at most config.MaxNodes nodes. Must be called with st.mu
+// held.
+func (st *searchState) enforceMaxNodes() {
+	policy := st.config.PrunePolicy
+	if policy == nil {
+		policy = FewestVisitsPrune{}
+	}
+
+	for atomic.LoadInt64(&st.nodes) > int64(st.config.MaxNodes) {
+		victim := policy.SelectPrune(&Tree{Root: st.root}, st.bestSequence)
+		if victim == nil || victim == st.root || !st.prune(victim, true) {
+			return
+		}
+	}
+}
+
+// pruneUncompetitive removes every subtree whose best recorded fitness is
+// worse than the best fitness found so far by more than config.PruneThreshold
+// of its magnitude. The path of the best sequence is kept, and so is the
+// best child of a node that would otherwise be left with no moves. Must be
+// called with st.mu held.
+func (st *searchState) pruneUncompetitive() {
+	if st.bestSequence == nil {
+		return
+	}
+	margin := math.Abs(st.bestFitness) * st.config.PruneThreshold
+	cutoff := st.bestFitness + margin
+	if st.config.Maximize {
+		cutoff = st.bestFitness - margin
+	}
+
+	queued := map[*Node]bool{st.root: true}
+	queue := []*Node{st.root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		node.mu.Lock()
+		children := append([]*Node(nil), node.children...)
+		untried := len(node.unusedMoves)
+		node.mu.Unlock()
+
+		var kept, victims []*Node
+		var best *Node
+		bestValue := worstFitness(st.config.Maximize)
+		for _, child := range children {
+			child.mu.Lock()
+			visits, value := child.visits, child.minFitness
+			if st.config.Maximize {
+				value = child.maxFitness
+			}
+			child.mu.Unlock()
+
+			if visits > 0 && isBetter(st.config.Maximize, value, bestValue) {
+				best, bestValue = child, value
+			}
+			if visits == 0 || isPrefix(child.sequence, st.bestSequence) || !isBetter(st.config.Maximize, cutoff, value) {
+				kept = append(kept, child)
+			} else {
+				victims = append(victims, child)
+			}
+		}
+		if len(kept) == 0 && untried == 0 && best != nil {
+			// Keep a move to explore below node
+			for i, victim := range victims {
+				if victim == best {
+					victims = append(victims[:i], victims[i+1:]...)
+					break
+				}
+			}
+			kept = append(kept, best)
+		}
+
+		for _, victim := range victims {
+			st.prune(victim, false)
+		}
+		for _, child := range kept {
+			if !queued[child] {
+				queued[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+}
+
+// isPrefix reports whether prefix is the start of sequence
+func isPrefix(prefix, sequence []interface{}) bool {
+	if len(prefix) > len(sequence) {
+		return false
+	}
+	for i, move := range prefix {
+		if !sameMove(move, sequence[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// prune detaches the subtree of node from its parent, and with
+// transpositions from every other parent sharing it. With giveBack the move
+// that led to it returns to the unused moves of each parent so it can be
+// explored again, otherwise it is dropped for the rest of the search.
+// Nodes below it still reached through other parents stay in the tree.
+// Returns false if node is not a child of its parent.
+func (st *searchState) prune(node *Node, giveBack bool) bool {
+	if node.parent == nil {
+		return false
+	}
+	parents := []*Node{node.parent}
+	if st.transpositions != nil {
+		parents = parentsOf(st.root, node)
+	}
+	found := false
+	for _, parent := range parents {
+		if unlink(parent, node, giveBack) {
+			found = true
+		}
+	}
+	if !found {
+		return false
+	}
+
+	var reachable map[*Node]*Node
+	if st.transpositions != nil {
+		reachable = reachedFrom(st.root)
+	}
+
+	removed := int64(0)
+	seen := make(map[*Node]bool)
+	stack := []*Node{node}
+	for len(stack) > 0 {
+		pruned := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[pruned] {
+			continue
+		}
+		seen[pruned] = true
+		if parent, ok := reachable[pruned]; ok {
+			// Shared with the rest of the tree, move it off its pruned parent
+			pruned.mu.Lock()
+			if _, kept := reachable[pruned.parent]; !kept {
+				pruned.parent = parent
+			}
+			pruned.mu.Unlock()
+			continue
+		}
+		stack = append(stack, pruned.childrenSnapshot()...)
+		removed++
+
+		// Forget pruned states so they are not adopted back into the tree
+		if st.transpositions != nil {
+			key := transpositionKey(pruned.sequence, &st.config)
+			if stored, ok := st.transpositions.Load(key); ok && stored == pruned {
+				st.transpositions.Delete(key)
+			}
+		}
+	}
+	atomic.AddInt64(&st.nodes, -removed)
+	return true
+}
+
+// unlink removes node from the children of parent, giving its move back to
+// the unused moves of parent with giveBack. Returns false if node is not a
+// child of parent.
+func unlink(parent, node *Node, giveBack bool) bool {
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+
+	for i, child := range parent.children {
+		if child == node {
+			parent.children = append(parent.children[:i], parent.children[i+1:]...)
+			if giveBack {
+				parent.unusedMoves = append(parent.unusedMoves, node.sequence[len(node.sequence)-1])
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// parentsOf returns every node below root that has node as a child, more
+// than one when transpositions share it
+func parentsOf(root, node *Node) []*Node {
+	var parents []*Node
+	Walk(root, func(candidate *Node) {
+		for _, child := range candidate.childrenSnapshot() {
+			if child == node {
+				parents = append(parents, candidate)
+				return
+			}
+		}
+	})
+	return parents
+}
+
+// reachedFrom maps every node from root down to the first parent it is
+// reached from, root itself to nil
+func reachedFrom(root *Node) map[*Node]*Node {
+	reached := map[*Node]*Node{root: nil}
+	queue := []*Node{root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, child := range node.childrenSnapshot() {
+			if _, ok := reached[child]; !ok {
+				reached[child] = node
+				queue = append(queue, child)
+			}
+		}
+	}
+	return reached
+}
@@ -0,0 +1,61 @@
+package mcts
+
+// SelectionPolicy chooses how children are scored during selection
+type SelectionPolicy string
+
+const (
+	// PolicyUCT scores children with plain UCT
+	PolicyUCT SelectionPolicy = "UCT"
+	// PolicyRAVE blends UCT with all-moves-as-first (AMAF) statistics,
+	// sharing the outcome of a rollout with every sibling whose move was
+	// played later in that rollout
+	PolicyRAVE SelectionPolicy = "RAVE"
+)
+
+// usesRAVE reports whether config selects PolicyRAVE
+func usesRAVE(config *Config) bool {
+	return config.Policy == PolicyRAVE
+}
+
+// calculateRAVE blends the mean fitness of node with its AMAF estimate. The
+// AMAF weight starts close to 1 and decays as real visits accumulate, the
+// faster the larger config.RAVEBias is. Must be called with node.mu held.
+func calculateRAVE(node *Node, explorationConstant float64, config *Config) float64 {
+	uct := calculateUCT(node, explorationConstant, config)
+	if node.visits == 0 || node.amafVisits == 0 {
+		return uct
+	}
+
+	n := float64(node.visits)
+	amafN := float64(node.amafVisits)
+	bias := config.RAVEBias
+	beta := amafN / (n + amafN + 4*bias*bias*n*amafN)
+
+	mean := node.totalFitness / n
+	amafMean := node.amafFitness / amafN
+	return uct + beta*(amafMean-mean)
+}
+
+// updateAMAF credits fitness to every child, along the path from node to the
+// root, whose move appears in sequence after the position of its parent
+func updateAMAF(node *Node, sequence []interface{}, fitness float64) {
+	for ; node != nil; node = node.parent {
+		depth := len(node.sequence)
+		if depth >= len(sequence) {
+			continue
+		}
+		played := sequence[depth:]
+
+		node.mu.Lock()
+		for _, child := range node.children {
+			if !containsMove(played, child.sequence[depth]) {
+				continue
+			}
+			child.mu.Lock()
+			child.amafVisits++
+			child.amafFitness += fitness
+			child.mu.Unlock()
+		}
+		node.mu.Unlock()
+	}
+}
@@ -0,0 +1,73 @@
+package mcts
+
+import (
+	"context"
+	"math/rand"
+)
+
+// explorationPerturbation is the maximum relative change applied to the
+// exploration constant on each restart
+const explorationPerturbation = 0.2
+
+// Searcher runs repeated searches on the same problem, keeping the best
+// sequence found across all of them. Every restart after the first one is
+// reseeded, replacing config.Rand when it is set, and uses a slightly
+// perturbed exploration constant, which helps escaping local optima a
+// single search got stuck in.
+//
+// When config.StateKey and config.PriorCacheSize are set, the priors
+// computed by config.PriorFunc are cached by state for the lifetime of the
+// Searcher, so positions recurring across calls to Run are not scored again.
+type Searcher struct {
+	nextElements NextElementsFunc
+	fitnessFunc  FitnessFunc
+	config       Config
+
+	RestartCount int // Number of completed calls to Run
+
+	bestSequence []interface{}
+	bestFitness  float64
+}
+
+// NewSearcher creates a Searcher for the given problem and base configuration
+func NewSearcher(nextElements NextElementsFunc, fitnessFunc FitnessFunc, config Config) *Searcher {
+	if config.ExplorationConstant == 0 {
+		config.ExplorationConstant = defaultExplorationConstant
+	}
+	if config.PriorFunc != nil && config.StateKey != nil && config.PriorCacheSize > 0 {
+		config.PriorFunc = newPriorCache(config.PriorCacheSize).wrap(config.PriorFunc, config.StateKey)
+	}
+	return &Searcher{
+		nextElements: nextElements,
+		fitnessFunc:  fitnessFunc,
+		config:       config,
+	}
+}
+
+// Run performs one more search from initialSequence and returns the best
+// sequence found over all restarts so far. initialSequence is expected to
+// be the same on every call.
+func (s *Searcher) Run(initialSequence []interface{}) ([]interface{}, error) {
+	config := s.config
+	if s.RestartCount > 0 {
+		config.RandomSeed = s.config.RandomSeed + int64(s.RestartCount)
+		rng := rand.New(rand.NewSource(config.RandomSeed))
+		config.ExplorationConstant *= 1 + explorationPerturbation*(2*rng.Float64()-1)
+		if config.Rand != nil {
+			config.Rand = rand.New(rand.NewSource(config.RandomSeed)) // Otherwise the reseed would be ignored
+		}
+	}
+
+	result, err := RunDetailed(context.Background(), initialSequence, s.nextElements, s.fitnessFunc, config)
+	if err != nil {
+		return nil, err
+	}
+	s.RestartCount++
+
+	if s.bestSequence == nil || isBetter(s.config.Maximize, result.BestFitness, s.bestFitness) {
+		s.bestFitness = result.BestFitness
+		s.bestSequence = result.BestSequence
+	}
+
+	return append([]interface{}(nil), s.bestSequence...), nil
+}
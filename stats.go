@@ -0,0 +1,63 @@
+package mcts
+
+import "math/bits"
+
+// treeStatsDepthCap is the deepest level below the root TreeStats descends to
+const treeStatsDepthCap = 10000
+
+// Stats aggregates the shape of a search tree and how its visits are spread
+type Stats struct {
+	TotalNodes     int     `json:"total_nodes"`
+	LeafNodes      int     `json:"leaf_nodes"`      // Nodes without children
+	MaxDepth       int     `json:"max_depth"`       // Deepest level below the root, which is at depth 0
+	AvgBranching   float64 `json:"avg_branching"`   // Mean number of children of the nodes that have any
+	VisitHistogram []int   `json:"visit_histogram"` // Bucket 0 counts unvisited nodes, bucket b nodes with 2^(b-1) to 2^b-1 visits
+	Truncated      bool    `json:"truncated"`       // Whether nodes below the depth cap were left out
+}
+
+// TreeStats walks the tree below root breadth-first and returns its Stats.
+// Levels deeper than 10000 are left out, setting Truncated, so that
+// degenerate trees neither take unbounded time nor risk the stack.
+func TreeStats(root *Node) Stats {
+	var stats Stats
+	if root == nil {
+		return stats
+	}
+
+	branches, inner := 0, 0
+	level := []*Node{root}
+	for depth := 0; len(level) > 0; depth++ {
+		stats.MaxDepth = depth
+
+		var next []*Node
+		for _, node := range level {
+			children := node.childrenSnapshot()
+			visits := node.Visits()
+
+			stats.TotalNodes++
+			bucket := bits.Len(uint(visits))
+			for len(stats.VisitHistogram) <= bucket {
+				stats.VisitHistogram = append(stats.VisitHistogram, 0)
+			}
+			stats.VisitHistogram[bucket]++
+
+			if len(children) == 0 {
+				stats.LeafNodes++
+				continue
+			}
+			branches += len(children)
+			inner++
+			if depth == treeStatsDepthCap {
+				stats.Truncated = true
+				continue
+			}
+			next = append(next, children...)
+		}
+		level = next
+	}
+
+	if inner > 0 {
+		stats.AvgBranching = float64(branches) / float64(inner)
+	}
+	return stats
+}
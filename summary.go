@@ -0,0 +1,72 @@
+package mcts
+
+import "sort"
+
+// summaryAlternatives is the number of runner-up moves kept in a Summary
+const summaryAlternatives = 3
+
+// MoveSummary describes one first move considered by the search
+type MoveSummary struct {
+	Move        interface{} `json:"move"`
+	Visits      int         `json:"visits"`
+	MeanFitness float64     `json:"mean_fitness"`
+}
+
+// Summary is a compact, JSON-serializable record of a search decision,
+// suitable for logging every move of a game
+type Summary struct {
+	Chosen       MoveSummary   `json:"chosen"`
+	Iterations   int           `json:"iterations"`
+	Confidence   float64       `json:"confidence"` // Share of the root visits spent on the chosen move
+	ElapsedMS    int64         `json:"elapsed_ms"`
+	Alternatives []MoveSummary `json:"alternatives"` // Most visited other first moves, at most three
+}
+
+// DecisionSummary summarizes the first move of result.BestSequence and its
+// most visited alternatives at the root of the search tree
+func DecisionSummary(result *Result) Summary {
+	summary := Summary{
+		Iterations:   result.Iterations,
+		ElapsedMS:    result.Elapsed.Milliseconds(),
+		Alternatives: []MoveSummary{},
+	}
+
+	root := result.Root
+	depth := 0
+	if root != nil {
+		depth = len(root.sequence)
+	}
+	if depth >= len(result.BestSequence) {
+		return summary
+	}
+	summary.Chosen.Move = result.BestSequence[depth]
+	if root == nil {
+		return summary
+	}
+
+	children := root.childrenSnapshot()
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Visits() > children[j].Visits()
+	})
+
+	total := 0
+	for _, child := range children {
+		move := MoveSummary{
+			Move:        child.sequence[depth],
+			Visits:      child.Visits(),
+			MeanFitness: child.MeanFitness(),
+		}
+		total += move.Visits
+
+		if move.Move == summary.Chosen.Move {
+			summary.Chosen = move
+		} else if len(summary.Alternatives) < summaryAlternatives {
+			summary.Alternatives = append(summary.Alternatives, move)
+		}
+	}
+	if total > 0 {
+		summary.Confidence = float64(summary.Chosen.Visits) / float64(total)
+	}
+
+	return summary
+}
@@ -0,0 +1,70 @@
+package mcts
+
+import "math/rand"
+
+// isTabu reports whether config.TabuFunc rejects sequence
+func isTabu(sequence []interface{}, config *Config) bool {
+	return config.TabuFunc != nil && config.TabuFunc(sequence)
+}
+
+// tabuRollout completes sequence like simulation while skipping every move
+// config.TabuFunc rejects. When all moves after a prefix are tabu, the
+// rollout backtracks to the last prefix that still has untried moves,
+// never undoing the moves sequence started with. Chance moves cannot be
+// retried, so backtracking goes past them.
+func tabuRollout(sequence []interface{}, nextElements NextElementsFunc, config *Config, rng *rand.Rand, limit int) []interface{} {
+	var untried [][]interface{} // Alternatives left for each move appended so far
+	var pending []interface{}   // Candidates for the next move
+	fresh := true               // Whether pending still has to be computed for the current prefix
+
+	for !isSequenceComplete(sequence, *config) && len(sequence) != limit {
+		if fresh {
+			if isChance(sequence, config) {
+				sequence = append(sequence, config.ChanceOutcome(sequence, rng))
+				untried = append(untried, nil)
+				continue
+			}
+			pending = append([]interface{}(nil), nextElements(sequence)...)
+			if len(pending) == 0 {
+				break
+			}
+		}
+
+		if move, ok := nextAllowedMove(sequence, &pending, config, rng); ok {
+			sequence = append(sequence, move)
+			untried = append(untried, pending)
+			fresh = true
+			continue
+		}
+
+		// Every move after this prefix is tabu, back up one move
+		if len(untried) == 0 {
+			break
+		}
+		sequence = sequence[:len(sequence)-1]
+		pending = untried[len(untried)-1]
+		untried = untried[:len(untried)-1]
+		fresh = false
+	}
+
+	return sequence
+}
+
+// nextAllowedMove draws rollout moves from pending, removing each one drawn,
+// until one is not tabu after sequence
+func nextAllowedMove(sequence []interface{}, pending *[]interface{}, config *Config, rng *rand.Rand) (interface{}, bool) {
+	for len(*pending) > 0 {
+		move := rolloutMove(sequence, *pending, config, rng)
+		for i, candidate := range *pending {
+			if sameMove(candidate, move) {
+				*pending = append((*pending)[:i], (*pending)[i+1:]...)
+				break
+			}
+		}
+
+		if !isTabu(append(sequence[:len(sequence):len(sequence)], move), config) {
+			return move, true
+		}
+	}
+	return nil, false
+}
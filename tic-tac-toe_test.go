@@ -1,8 +1,13 @@
 package mcts
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"math"
+	"math/rand"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -360,74 +365,1058 @@ func TestMCTSTicTacToe(t *testing.T) {
 		},
 	}
 
-	for _, tt := range testCases {
-		t.Run(tt.name, func(t *testing.T) {
-			state := &TicTacToeState{
-				board:    tt.initialBoard,
-				nextMove: tt.nextPlayer,
-				moves:    []int{},
+	for _, maximize := range []bool{false, true} {
+		for _, tt := range testCases {
+			name := tt.name
+			if maximize {
+				name += " Maximize"
 			}
+			t.Run(name, func(t *testing.T) {
+				state := &TicTacToeState{
+					board:    tt.initialBoard,
+					nextMove: tt.nextPlayer,
+					moves:    []int{},
+				}
+
+				problem := &TicTacToeProblem{
+					initialState: state,
+					player:       tt.nextPlayer,
+				}
+
+				// Maximizing the negated fitness must pick the same moves
+				fitness := problem.fitness
+				if maximize {
+					fitness = func(sequence []interface{}) float64 {
+						return -problem.fitness(sequence)
+					}
+				}
+
+				config := Config{
+					ExplorationConstant: tt.explorationConstant,
+					MaxIterations:       tt.iterations,
+					TargetSeqLength:     1,
+					RandomSeed:          1,
+					DebugLevel:          0,
+					Maximize:            maximize,
+				}
+
+				moveStats := make(map[int]int)
+				numAttempts := 100
+
+				for i := 0; i < numAttempts; i++ {
+					config.RandomSeed = int64(i)
+					sequence, err := Run([]interface{}{}, problem.nextElements, fitness, config)
+
+					if err != nil {
+						t.Fatalf("MCTS failed: %v", err)
+					}
+
+					if len(sequence) > 0 {
+						move := sequence[0].(int)
+						moveStats[move]++
+					}
+				}
+
+				// Print board state and move distribution
+				t.Logf("\nInitial board state:%s", state)
+				t.Logf("Move distribution over %d attempts:", numAttempts)
+				for move, count := range moveStats {
+					t.Logf("Position %d: %d times (%.1f%%)",
+						move, count, float64(count)*100/float64(numAttempts))
+				}
+
+				// Check if expected moves were chosen enough times
+				totalExpectedMoves := 0
+				for _, expectedMove := range tt.expectedMoves {
+					count := moveStats[expectedMove]
+					totalExpectedMoves += count
+					if count == 0 {
+						t.Errorf("Expected move %d was never chosen", expectedMove)
+					}
+				}
+
+				actualRate := float64(totalExpectedMoves) / float64(numAttempts)
+				if actualRate < tt.minExpectedRate {
+					t.Errorf("Expected moves chosen only %.1f%% of the time, want at least %.1f%%",
+						actualRate*100, tt.minExpectedRate*100)
+				}
+
+				// Check that banned moves were never chosen
+				for _, bannedMove := range tt.bannedMoves {
+					if count := moveStats[bannedMove]; count > 0 {
+						t.Errorf("Banned move %d was chosen %d times", bannedMove, count)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestHottestNodeOnForcedWin(t *testing.T) {
+	state := &TicTacToeState{
+		board: [9]int{
+			1, 0, 0,
+			1, 2, 2,
+			0, 0, 0,
+		},
+		nextMove: 1,
+		moves:    []int{},
+	}
+
+	problem := &TicTacToeProblem{
+		initialState: state,
+		player:       1,
+	}
+
+	config := Config{
+		ExplorationConstant: 0.5,
+		MaxIterations:       500,
+		TargetSeqLength:     1,
+		RandomSeed:          1,
+	}
+
+	root, _, err := search(context.Background(), []interface{}{}, problem.nextElements, problem.fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	hottest := HottestNode(root)
+	if hottest == nil {
+		t.Fatal("Expected a hottest node, got nil")
+	}
+
+	// The winning line is the left column {0, 3, 6}
+	move := hottest.sequence[len(hottest.sequence)-1].(int)
+	if move != 6 {
+		t.Errorf("Expected hottest node to play winning move 6, got %d (visits %d)", move, hottest.visits)
+	}
+}
+
+func TestRolloutPrefixFindsWinFaster(t *testing.T) {
+	// O to move; X threatens 2, 7 and 8, so X wins on the following move
+	initial := &TicTacToeState{
+		board: [9]int{
+			1, 1, 0,
+			2, 1, 0,
+			2, 0, 0,
+		},
+		nextMove: 2,
+		moves:    []int{},
+	}
+
+	replay := func(sequence []interface{}) *TicTacToeState {
+		state := initial.Copy()
+		for _, move := range sequence {
+			state.MakeMove(move.(int))
+		}
+		return state
+	}
 
-			problem := &TicTacToeProblem{
-				initialState: state,
-				player:       tt.nextPlayer,
+	nextElements := func(sequence []interface{}) []interface{} {
+		state := replay(sequence)
+		if state.gameOver {
+			return nil
+		}
+		var moves []interface{}
+		for i := 0; i < 9; i++ {
+			if state.board[i] == 0 {
+				moves = append(moves, i)
+			}
+		}
+		return moves
+	}
+
+	problem := &TicTacToeProblem{initialState: initial, player: 1}
+
+	// Expert policy: X always plays an immediate win when one is available
+	prefix := func(sequence []interface{}) []interface{} {
+		state := replay(sequence)
+		if state.gameOver || state.nextMove != 1 {
+			return nil
+		}
+		if move := problem.findImmediateWin(state, 1); move >= 0 {
+			return []interface{}{move}
+		}
+		return nil
+	}
+
+	// evaluationsUntilWin reports how many fitness evaluations the search
+	// needed before it first rolled out an X win
+	evaluationsUntilWin := func(seed int64, rolloutPrefix func([]interface{}) []interface{}) int {
+		evaluations, firstWin := 0, 0
+		fitness := func(sequence []interface{}) float64 {
+			evaluations++
+			state := replay(sequence)
+			if state.gameOver && state.winner == 1 {
+				if firstWin == 0 {
+					firstWin = evaluations
+				}
+				return -1
 			}
+			if state.gameOver && state.winner == 2 {
+				return 1
+			}
+			return 0
+		}
+
+		config := Config{
+			MaxIterations:        50,
+			TargetSeqLength:      -1,
+			RandomSeed:           seed,
+			IsSequenceTerminated: func(sequence []interface{}) bool { return replay(sequence).gameOver },
+			RolloutPrefix:        rolloutPrefix,
+		}
+		if _, err := Run([]interface{}{}, nextElements, fitness, config); err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+		if firstWin == 0 {
+			return config.MaxIterations + 1
+		}
+		return firstWin
+	}
+
+	const seeds = 50
+	withPrefix, withoutPrefix := 0, 0
+	for seed := int64(0); seed < seeds; seed++ {
+		with := evaluationsUntilWin(seed, prefix)
+		if with != 1 {
+			t.Errorf("Seed %d: expected the first rollout to win with the prefix, took %d", seed, with)
+		}
+		withPrefix += with
+		withoutPrefix += evaluationsUntilWin(seed, nil)
+	}
+
+	t.Logf("Average evaluations until win: with prefix %.2f, without prefix %.2f",
+		float64(withPrefix)/seeds, float64(withoutPrefix)/seeds)
+
+	if withPrefix >= withoutPrefix {
+		t.Errorf("Expected the prefix to find the win faster (%d vs %d evaluations)", withPrefix, withoutPrefix)
+	}
+}
+
+func TestRolloutPolicyTakesCenter(t *testing.T) {
+	// X opens on an empty board, the center is the strongest first move
+	initial := &TicTacToeState{
+		board: [9]int{
+			0, 0, 0,
+			0, 0, 0,
+			0, 0, 0,
+		},
+		nextMove: 1,
+		moves:    []int{},
+	}
+
+	replay := func(sequence []interface{}) *TicTacToeState {
+		state := initial.Copy()
+		for _, move := range sequence {
+			state.MakeMove(move.(int))
+		}
+		return state
+	}
+
+	nextElements := func(sequence []interface{}) []interface{} {
+		state := replay(sequence)
+		if state.gameOver {
+			return nil
+		}
+		var moves []interface{}
+		for i := 0; i < 9; i++ {
+			if state.board[i] == 0 {
+				moves = append(moves, i)
+			}
+		}
+		return moves
+	}
+
+	fitness := func(sequence []interface{}) float64 {
+		switch replay(sequence).winner {
+		case 1:
+			return -1
+		case 2:
+			return 1
+		}
+		return 0
+	}
 
+	// centerRate reports how often the most visited first move is the center
+	centerRate := func(policy func(seed int64) RolloutPolicyFunc) float64 {
+		const seeds = 100
+		centers := 0
+		for seed := int64(0); seed < seeds; seed++ {
 			config := Config{
-				ExplorationConstant: tt.explorationConstant,
-				MaxIterations:       tt.iterations,
-				TargetSeqLength:     1,
-				RandomSeed:          1,
-				DebugLevel:          0,
+				MaxIterations:          300,
+				TargetSeqLength:        -1,
+				RandomSeed:             seed,
+				IsSequenceTerminated:   func(sequence []interface{}) bool { return replayTicTacToe(sequence).gameOver },
+				GuaranteeFullExpansion: true,
+				RolloutPolicy:          policy(seed),
 			}
+			result, err := RunDetailed(context.Background(), []interface{}{}, nextElements, fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed: %v", err)
+			}
+			if mostVisitedChild(result.Root).sequence[0] == 4 {
+				centers++
+			}
+		}
+		return float64(centers) / seeds
+	}
 
-			moveStats := make(map[int]int)
-			numAttempts := 100
+	// Biased rollouts take the center whenever it is free, otherwise play randomly
+	uniform := centerRate(func(int64) RolloutPolicyFunc { return nil })
+	biased := centerRate(func(seed int64) RolloutPolicyFunc {
+		rng := rand.New(rand.NewSource(seed))
+		return func(sequence []interface{}, moves []interface{}) interface{} {
+			if containsMove(moves, 4) {
+				return 4
+			}
+			return moves[rng.Intn(len(moves))]
+		}
+	})
 
-			for i := 0; i < numAttempts; i++ {
-				config.RandomSeed = int64(i)
-				sequence, err := Run([]interface{}{}, problem.nextElements, problem.fitness, config)
+	t.Logf("Center chosen with uniform rollouts %.0f%%, with center-biased rollouts %.0f%%", uniform*100, biased*100)
 
-				if err != nil {
-					t.Fatalf("MCTS failed: %v", err)
-				}
+	if biased < uniform+0.1 {
+		t.Errorf("Expected center-biased rollouts to choose the center clearly more often (%.2f vs %.2f)", biased, uniform)
+	}
+}
 
-				if len(sequence) > 0 {
-					move := sequence[0].(int)
-					moveStats[move]++
-				}
+// growTicTacToeTree tries every root move once so the search branches at
+// the root, then lets regular iterations grow the tree below them
+func growTicTacToeTree(problem *TicTacToeProblem, iterations int) *Node {
+	config := Config{
+		ExplorationConstant: 0.5,
+		TargetSeqLength:     -1,
+		IsSequenceTerminated: func(sequence []interface{}) bool {
+			return len(problem.nextElements(sequence)) == 0
+		},
+	}
+	rng := rand.New(rand.NewSource(1))
+
+	root := &Node{sequence: []interface{}{}, unusedMoves: problem.nextElements(nil)}
+	for len(root.unusedMoves) > 0 {
+		child := expansion(root, problem.nextElements, config, math.MaxFloat64, rng, nil)
+		backpropagate(child, problem.fitness(simulation(child, problem.nextElements, config, rng)))
+	}
+	for i := 0; i < iterations; i++ {
+		selected := selection(root, config.ExplorationConstant, config, math.MaxFloat64, nil, nil)
+		if expanded := expansion(selected, problem.nextElements, config, math.MaxFloat64, rng, nil); expanded != nil {
+			backpropagate(expanded, problem.fitness(simulation(expanded, problem.nextElements, config, rng)))
+		}
+	}
+	return root
+}
+
+func TestMultiPV(t *testing.T) {
+	state := &TicTacToeState{
+		board: [9]int{
+			1, 0, 0,
+			0, 2, 0,
+			0, 0, 0,
+		},
+		nextMove: 1,
+		moves:    []int{},
+	}
+
+	problem := &TicTacToeProblem{
+		initialState: state,
+		player:       1,
+	}
+
+	root := growTicTacToeTree(problem, 500)
+
+	lines := MultiPV(root, 2, Config{})
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 principal variations, got %d", len(lines))
+	}
+
+	first, second := lines[0][0], lines[1][0]
+	if first == second {
+		t.Fatalf("Expected distinct lines, both start with %v", first)
+	}
+
+	visits := make(map[interface{}]int)
+	for _, child := range root.children {
+		visits[child.sequence[0]] = child.visits
+	}
+	for _, child := range root.children {
+		move := child.sequence[0]
+		if move != first && move != second && child.visits > visits[second] {
+			t.Errorf("Root move %v has %d visits, more than second line start %v with %d",
+				move, child.visits, second, visits[second])
+		}
+	}
+	if visits[first] < visits[second] {
+		t.Errorf("Expected lines ordered by visits, got %d then %d", visits[first], visits[second])
+	}
+	if pv := PrincipalVariation(root); fmt.Sprint(lines[0]) != fmt.Sprint(pv) {
+		t.Errorf("Expected the first line to be the principal variation %v, got %v", pv, lines[0])
+	}
+
+	// Lines below a deeper root only hold the moves below it
+	child := mostVisitedChild(root)
+	for _, line := range MultiPV(child, 3, Config{}) {
+		if len(line) == 0 || len(line) > 8 || line[0] == child.sequence[0] {
+			t.Errorf("Expected the moves below %v, got %v", child.sequence, line)
+		}
+	}
+
+	// Other criteria rank the root children by value
+	config := Config{FinalSelectionCriteria: FinalSelectionBestFitness, Maximize: true}
+	if best := MultiPV(root, 1, config); len(best) != 1 || best[0][0] != selectBestChild(root, config.FinalSelectionCriteria, &config).sequence[0] {
+		t.Errorf("Expected the line of the best valued child, got %v", best)
+	}
+
+	if lines := MultiPV(root, -1, Config{}); lines != nil {
+		t.Errorf("Expected no lines for a negative count, got %v", lines)
+	}
+
+	t.Logf("Principal variations: %v", lines)
+}
+
+func TestTreeBalance(t *testing.T) {
+	forced := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board: [9]int{
+				1, 0, 0,
+				1, 2, 2,
+				0, 0, 0,
+			},
+			nextMove: 1,
+			moves:    []int{},
+		},
+		player: 1,
+	}
+
+	open := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board: [9]int{
+				0, 0, 0,
+				0, 1, 0,
+				0, 0, 0,
+			},
+			nextMove: 2,
+			moves:    []int{},
+		},
+		player: 2,
+	}
+
+	forcedBalance := TreeBalance(growTicTacToeTree(forced, 500))
+	openBalance := TreeBalance(growTicTacToeTree(open, 500))
+
+	t.Logf("Balance: forced win %.3f, open position %.3f", forcedBalance, openBalance)
+
+	if forcedBalance > 0.1 {
+		t.Errorf("Expected a forced win to concentrate visits, got balance %.3f", forcedBalance)
+	}
+	if openBalance <= forcedBalance || openBalance < 0.5 {
+		t.Errorf("Expected an open position to spread visits, got balance %.3f (forced %.3f)", openBalance, forcedBalance)
+	}
+}
+
+func TestBestMoveVariance(t *testing.T) {
+	forced := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board: [9]int{
+				1, 0, 0,
+				1, 2, 2,
+				0, 0, 0,
+			},
+			nextMove: 1,
+			moves:    []int{},
+		},
+		player: 1,
+	}
+
+	open := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board:    [9]int{},
+			nextMove: 1,
+			moves:    []int{},
+		},
+		player: 1,
+	}
+
+	forcedRoot := growTicTacToeTree(forced, 500)
+	if move := mostVisitedChild(forcedRoot).sequence[0]; move != 6 {
+		t.Fatalf("Expected winning move 6 to be the best move, got %v", move)
+	}
+
+	forcedVariance := BestMoveVariance(forcedRoot)
+	openVariance := BestMoveVariance(growTicTacToeTree(open, 500))
+
+	t.Logf("Variance: forced win %.3f, open position %.3f", forcedVariance, openVariance)
+
+	if forcedVariance > 1e-6 {
+		t.Errorf("Expected a forced win to have near-zero variance, got %.3f", forcedVariance)
+	}
+	if openVariance <= forcedVariance {
+		t.Errorf("Expected an open position to have higher variance, got %.3f (forced %.3f)", openVariance, forcedVariance)
+	}
+}
+
+func TestGuaranteeFullExpansion(t *testing.T) {
+	problem := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board: [9]int{
+				1, 1, 0,
+				0, 2, 0,
+				0, 0, 0,
+			},
+			nextMove: 2,
+			moves:    []int{},
+		},
+		player: 2,
+	}
+
+	// Offer every empty cell at the root instead of only the forced block,
+	// replies keep the forced wins and blocks of the regular move generator
+	allMoves := func(sequence []interface{}) []interface{} {
+		if len(sequence) > 0 {
+			return problem.nextElements(sequence)
+		}
+		var moves []interface{}
+		for i, cell := range problem.initialState.board {
+			if cell == 0 {
+				moves = append(moves, i)
 			}
+		}
+		return moves
+	}
+
+	legalMoves := allMoves(nil)
+
+	config := Config{
+		ExplorationConstant:    0.5,
+		MaxIterations:          len(legalMoves) + 4,
+		TargetSeqLength:        -1,
+		GuaranteeFullExpansion: true,
+		IsSequenceTerminated: func(sequence []interface{}) bool {
+			return len(allMoves(sequence)) == 0
+		},
+	}
+
+	for seed := int64(0); seed < 20; seed++ {
+		config.RandomSeed = seed
+		root, result, err := search(context.Background(), []interface{}{}, allMoves, problem.fitness, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
 
-			// Print board state and move distribution
-			t.Logf("\nInitial board state:%s", state)
-			t.Logf("Move distribution over %d attempts:", numAttempts)
-			for move, count := range moveStats {
-				t.Logf("Position %d: %d times (%.1f%%)",
-					move, count, float64(count)*100/float64(numAttempts))
+		expanded := make(map[interface{}]bool)
+		for _, child := range root.children {
+			if child.visits > 0 {
+				expanded[child.sequence[0]] = true
 			}
+		}
+		for _, move := range legalMoves {
+			if !expanded[move] {
+				t.Errorf("Seed %d: legal move %v was never tried", seed, move)
+			}
+		}
 
-			// Check if expected moves were chosen enough times
-			totalExpectedMoves := 0
-			for _, expectedMove := range tt.expectedMoves {
-				count := moveStats[expectedMove]
-				totalExpectedMoves += count
-				if count == 0 {
-					t.Errorf("Expected move %d was never chosen", expectedMove)
-				}
+		if move := result.BestSequence[0]; move != 2 {
+			t.Errorf("Seed %d: expected blocking move 2, got %v", seed, move)
+		}
+	}
+}
+
+// replayTicTacToe plays sequence from the empty board
+func replayTicTacToe(sequence []interface{}) *TicTacToeState {
+	state := &TicTacToeState{nextMove: 1, moves: []int{}}
+	for _, move := range sequence {
+		state.MakeMove(move.(int))
+	}
+	return state
+}
+
+// ticTacToeMoves returns every empty cell after sequence, for both players
+func ticTacToeMoves(sequence []interface{}) []interface{} {
+	state := replayTicTacToe(sequence)
+	if state.gameOver {
+		return nil
+	}
+	var moves []interface{}
+	for i, cell := range state.board {
+		if cell == 0 {
+			moves = append(moves, i)
+		}
+	}
+	return moves
+}
+
+// ticTacToeOutcome scores the game after sequence from the side of O
+func ticTacToeOutcome(sequence []interface{}) float64 {
+	switch replayTicTacToe(sequence).winner {
+	case 1:
+		return -1
+	case 2:
+		return 1
+	}
+	return 0
+}
+
+// ticTacToeBoard keys the state after sequence by its board, so move
+// orders reaching the same board are the same state
+func ticTacToeBoard(sequence []interface{}) string {
+	return fmt.Sprint(replayTicTacToe(sequence).board)
+}
+
+func TestStateKeyTranspositions(t *testing.T) {
+	// uniqueNodes runs a search and counts the distinct nodes of its tree,
+	// exploring widely so that no run stalls on a finished game
+	uniqueNodes := func(stateKey func(sequence []interface{}) string) int {
+		config := Config{
+			ExplorationConstant:    10,
+			MaxIterations:          5000,
+			TargetSeqLength:        -1,
+			RandomSeed:             1,
+			IsSequenceTerminated:   func(sequence []interface{}) bool { return replayTicTacToe(sequence).gameOver },
+			GuaranteeFullExpansion: true,
+			StateKey:               stateKey,
+			Transpositions:         stateKey != nil,
+		}
+		result, err := RunDetailed(context.Background(), []interface{}{}, ticTacToeMoves, ticTacToeOutcome, config)
+		if err != nil {
+			t.Fatalf("MCTS failed: %v", err)
+		}
+
+		unique := make(map[*Node]bool)
+		Walk(result.Root, func(node *Node) {
+			if unique[node] {
+				t.Errorf("Node %v was walked twice", node.sequence)
+			}
+			unique[node] = true
+			if node.parent != nil && !containsNode(node.parent.children, node) {
+				t.Errorf("Node %v is not a child of its parent", node.sequence)
+			}
+		})
+		if result.TotalNodes != len(unique) {
+			t.Errorf("Expected TotalNodes to count the %d distinct nodes, got %d", len(unique), result.TotalNodes)
+		}
+		return len(unique)
+	}
+
+	plain := uniqueNodes(nil)
+	shared := uniqueNodes(ticTacToeBoard)
+	t.Logf("%d nodes without transpositions, %d with", plain, shared)
+
+	if shared*2 > plain {
+		t.Errorf("Expected transpositions to at least halve the tree, got %d nodes vs %d", shared, plain)
+	}
+}
+
+func containsNode(nodes []*Node, node *Node) bool {
+	for _, candidate := range nodes {
+		if candidate == node {
+			return true
+		}
+	}
+	return false
+}
+
+func TestMarshalTreeTranspositions(t *testing.T) {
+	config := Config{
+		ExplorationConstant:    10,
+		MaxIterations:          2000,
+		TargetSeqLength:        -1,
+		RandomSeed:             1,
+		IsSequenceTerminated:   func(sequence []interface{}) bool { return replayTicTacToe(sequence).gameOver },
+		GuaranteeFullExpansion: true,
+		StateKey:               ticTacToeBoard,
+		Transpositions:         true,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, ticTacToeMoves, ticTacToeOutcome, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	data, err := MarshalTree(result.Root)
+	if err != nil {
+		t.Fatalf("MarshalTree failed: %v", err)
+	}
+	root, err := UnmarshalTree(data)
+	if err != nil {
+		t.Fatalf("UnmarshalTree failed: %v", err)
+	}
+
+	// parentCounts maps the sequence of every distinct node to its number
+	// of parents
+	parentCounts := func(root *Node) map[string]int {
+		counts := make(map[string]int)
+		visited := make(map[*Node]bool)
+		var walk func(node *Node)
+		walk = func(node *Node) {
+			if visited[node] {
+				return
+			}
+			visited[node] = true
+			for _, child := range node.children {
+				counts[fmt.Sprint(child.sequence)]++
+				walk(child)
 			}
+		}
+		walk(root)
+		return counts
+	}
+	original, restored := parentCounts(result.Root), parentCounts(root)
 
-			actualRate := float64(totalExpectedMoves) / float64(numAttempts)
-			if actualRate < tt.minExpectedRate {
-				t.Errorf("Expected moves chosen only %.1f%% of the time, want at least %.1f%%",
-					actualRate*100, tt.minExpectedRate*100)
+	shared := 0
+	for sequence, parents := range original {
+		if parents > 1 {
+			shared++
+		}
+		if restored[sequence] != parents {
+			t.Errorf("Expected %v to be restored under %d parents, got %d", sequence, parents, restored[sequence])
+		}
+	}
+	if shared == 0 {
+		t.Fatal("Expected the search to share nodes between transpositions")
+	}
+	if len(restored) != len(original) {
+		t.Errorf("Expected %d distinct nodes, got %d", len(original), len(restored))
+	}
+
+	Walk(root, func(node *Node) {
+		state := &TicTacToeState{nextMove: 1, moves: []int{}}
+		for _, move := range node.sequence {
+			if !state.MakeMove(move.(int)) {
+				t.Fatalf("Restored illegal game %v", node.sequence)
 			}
+		}
+	})
+}
 
-			// Check that banned moves were never chosen
-			for _, bannedMove := range tt.bannedMoves {
-				if count := moveStats[bannedMove]; count > 0 {
-					t.Errorf("Banned move %d was chosen %d times", bannedMove, count)
-				}
+func TestShrinkTreeTranspositions(t *testing.T) {
+	config := Config{
+		ExplorationConstant:    10,
+		MaxIterations:          5000,
+		TargetSeqLength:        -1,
+		RandomSeed:             1,
+		IsSequenceTerminated:   func(sequence []interface{}) bool { return replayTicTacToe(sequence).gameOver },
+		GuaranteeFullExpansion: true,
+		StateKey:               ticTacToeBoard,
+		Transpositions:         true,
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, ticTacToeMoves, ticTacToeOutcome, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	shrunk := ShrinkTree(&Tree{Root: result.Root}, 500)
+	if nodes := countNodes(shrunk.Root); nodes > 500 {
+		t.Errorf("Expected at most 500 nodes, got %d", nodes)
+	}
+	Walk(shrunk.Root, func(node *Node) {
+		seen := make(map[*Node]bool)
+		for _, child := range node.children {
+			if seen[child] {
+				t.Errorf("Expected %v to hold each child once, %v is repeated", node.sequence, child.sequence)
+			}
+			seen[child] = true
+		}
+	})
+}
+
+func TestMaxNodesTranspositions(t *testing.T) {
+	var last ProgressStats
+	config := Config{
+		ExplorationConstant:    10,
+		MaxIterations:          3000,
+		TargetSeqLength:        -1,
+		RandomSeed:             1,
+		IsSequenceTerminated:   func(sequence []interface{}) bool { return replayTicTacToe(sequence).gameOver },
+		GuaranteeFullExpansion: true,
+		StateKey:               ticTacToeBoard,
+		Transpositions:         true,
+		MaxNodes:               300,
+		PrunePolicy:            sharedFirstPrune{},
+		OnIteration:            func(i int, stats ProgressStats) { last = stats },
+	}
+	result, err := RunDetailed(context.Background(), []interface{}{}, ticTacToeMoves, ticTacToeOutcome, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+
+	// Pruning a shared node removes it from every parent and only counts
+	// the nodes no longer reached
+	shared := 0
+	Walk(result.Root, func(node *Node) {
+		for _, child := range node.children {
+			if child.parent != node {
+				shared++
 			}
+		}
+	})
+	if shared != 0 {
+		t.Errorf("Expected every shared node to be pruned, %d are left", shared)
+	}
+	if last.TotalNodes != result.TotalNodes || result.TotalNodes > config.MaxNodes {
+		t.Errorf("Expected the stats to count the %d nodes left, at most %d, got %d", result.TotalNodes, config.MaxNodes, last.TotalNodes)
+	}
+	Walk(result.Root, func(node *Node) {
+		if node.parent != nil && !containsNode(node.parent.children, node) {
+			t.Errorf("Node %v is not a child of its parent", node.sequence)
+		}
+	})
+}
+
+func TestVirtualLossTranspositions(t *testing.T) {
+	batch := func(sequences [][]interface{}) []float64 {
+		fitness := make([]float64, len(sequences))
+		for i, sequence := range sequences {
+			fitness[i] = ticTacToeOutcome(sequence)
+		}
+		return fitness
+	}
+	hash := func(sequence []interface{}) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(ticTacToeBoard(sequence)))
+		return h.Sum64()
+	}
+
+	for name, config := range map[string]Config{
+		"HashFunc": {HashFunc: hash},
+		"StateKey": {StateKey: ticTacToeBoard, Transpositions: true},
+	} {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			config.ExplorationConstant = 10
+			config.MaxIterations = 2000
+			config.TargetSeqLength = -1
+			config.RandomSeed = 1
+			config.IsSequenceTerminated = func(sequence []interface{}) bool { return replayTicTacToe(sequence).gameOver }
+			config.BatchFitness = batch
+			config.BatchSize = 8
+
+			result, err := RunDetailed(context.Background(), []interface{}{}, ticTacToeMoves, ticTacToeOutcome, config)
+			if err != nil {
+				t.Fatalf("MCTS failed: %v", err)
+			}
+			// Virtual loss is cleared along the path selection took, not the
+			// parent pointers transpositions move
+			Walk(result.Root, func(node *Node) {
+				if node.virtualLoss != 0 {
+					t.Errorf("Expected no virtual loss left on %v, got %d", node.sequence, node.virtualLoss)
+				}
+			})
 		})
 	}
 }
+
+// sharedFirstPrune prunes nodes shared by transpositions before any other
+type sharedFirstPrune struct{}
+
+func (sharedFirstPrune) SelectPrune(tree *Tree, bestSequence []interface{}) *Node {
+	parents := make(map[*Node]int)
+	var shared *Node
+	Walk(tree.Root, func(node *Node) {
+		for _, child := range node.childrenSnapshot() {
+			parents[child]++
+			if parents[child] > 1 && shared == nil && !isPrefix(child.sequence, bestSequence) {
+				shared = child
+			}
+		}
+	})
+	if shared != nil {
+		return shared
+	}
+	return FewestVisitsPrune{}.SelectPrune(tree, bestSequence)
+}
+
+func TestTerminalInitialSequence(t *testing.T) {
+	problem := &TicTacToeProblem{
+		initialState: &TicTacToeState{nextMove: 1, moves: []int{}},
+		player:       1,
+	}
+	// X takes the top row, the game is over and there are no moves left
+	finished := []interface{}{0, 3, 1, 4, 2}
+
+	evaluations := 0
+	fitness := func(sequence []interface{}) float64 {
+		evaluations++
+		return problem.fitness(sequence)
+	}
+	config := Config{
+		ExplorationConstant: 1.41,
+		MaxIterations:       1000000,
+		TargetSeqLength:     9,
+		RandomSeed:          1,
+	}
+
+	result, err := RunDetailed(context.Background(), finished, problem.nextElements, fitness, config)
+	if err != nil {
+		t.Fatalf("MCTS failed: %v", err)
+	}
+	if !result.Terminal || result.Iterations != 0 || evaluations != 1 {
+		t.Errorf("Expected an immediate return, got terminal %v after %d iterations and %d evaluations",
+			result.Terminal, result.Iterations, evaluations)
+	}
+	if fmt.Sprint(result.BestSequence) != fmt.Sprint(finished) || result.BestFitness != -10000 {
+		t.Errorf("Expected the finished game %v with fitness -10000, got %v (fitness %f)", finished, result.BestSequence, result.BestFitness)
+	}
+
+	// A sequence already at TargetSeqLength is complete as well
+	config.TargetSeqLength = len(finished)
+	if sequence, err := Run(finished, problem.nextElements, problem.fitness, config); err != nil || fmt.Sprint(sequence) != fmt.Sprint(finished) {
+		t.Errorf("Expected %v back for a complete sequence, got %v (%v)", finished, sequence, err)
+	}
+}
+
+// ticTacToeValue is the outcome of state under perfect play: 1 when player
+// wins, 0 for a draw and -1 when player loses
+func ticTacToeValue(state *TicTacToeState, player int) int {
+	if state.gameOver {
+		switch state.winner {
+		case player:
+			return 1
+		case 0:
+			return 0
+		}
+		return -1
+	}
+
+	best := -2
+	for pos := 0; pos < 9; pos++ {
+		next := state.Copy()
+		if !next.MakeMove(pos) {
+			continue
+		}
+		value := ticTacToeValue(next, player)
+		if state.nextMove != player {
+			value = -value
+		}
+		if value > best {
+			best = value
+		}
+	}
+	if state.nextMove != player {
+		return -best
+	}
+	return best
+}
+
+func TestMostVisitsSelection(t *testing.T) {
+	// X took a corner, and only the center saves O from a fork
+	problem := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board: [9]int{
+				1, 0, 0,
+				0, 0, 0,
+				0, 0, 0,
+			},
+			nextMove: 2,
+			moves:    []int{},
+		},
+		player: 2,
+	}
+
+	// Every empty cell is offered at the root, so one lucky rollout after a
+	// losing move can make it look best
+	allMoves := func(sequence []interface{}) []interface{} {
+		if len(sequence) > 0 {
+			return problem.nextElements(sequence)
+		}
+		var moves []interface{}
+		for i, cell := range problem.initialState.board {
+			if cell == 0 {
+				moves = append(moves, i)
+			}
+		}
+		return moves
+	}
+
+	optimal := ticTacToeValue(problem.initialState, problem.player)
+	successRate := func(criteria string) float64 {
+		config := Config{
+			MaxIterations:          40,
+			TargetSeqLength:        -1,
+			FinalSelectionCriteria: criteria,
+			IsSequenceTerminated: func(sequence []interface{}) bool {
+				return len(allMoves(sequence)) == 0
+			},
+		}
+		successes := 0
+		for seed := int64(0); seed < 100; seed++ {
+			config.RandomSeed = seed
+			sequence, err := Run([]interface{}{}, allMoves, problem.fitness, config)
+			if err != nil {
+				t.Fatalf("MCTS failed: %v", err)
+			}
+			state := problem.initialState.Copy()
+			state.MakeMove(sequence[0].(int))
+			if ticTacToeValue(state, problem.player) == optimal {
+				successes++
+			}
+		}
+		return float64(successes) / 100
+	}
+
+	bestRollout := successRate("")
+	mostVisits := successRate(FinalSelectionMostVisits)
+	t.Logf("Center chosen %.0f%% of the time by best rollout, %.0f%% by most visits", bestRollout*100, mostVisits*100)
+	if mostVisits <= bestRollout {
+		t.Errorf("Most visits selection succeeded %.0f%% of the time, expected more than the %.0f%% of best rollout",
+			mostVisits*100, bestRollout*100)
+	}
+}
+
+func TestWriteDOT(t *testing.T) {
+	problem := &TicTacToeProblem{
+		initialState: &TicTacToeState{
+			board:    [9]int{1, 0, 0, 0, 2, 0, 0, 0, 1},
+			nextMove: 2,
+			moves:    []int{},
+		},
+		player: 2,
+	}
+	root := growTicTacToeTree(problem, 50)
+
+	nodePattern := regexp.MustCompile(`^  n(\d+) \[label="(?:[^"\\]|\\.)*"\];$`)
+	edgePattern := regexp.MustCompile(`^  n(\d+) -> n(\d+) \[penwidth=\d+\.\d+\];$`)
+
+	// Writes the tree down to maxDepth and checks the output is a well
+	// formed digraph, returning its node and edge counts
+	render := func(maxDepth int) (int, int) {
+		var b strings.Builder
+		if err := WriteDOT(&b, root, Config{}, maxDepth); err != nil {
+			t.Fatalf("WriteDOT failed: %v", err)
+		}
+		lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+		if lines[0] != "digraph mcts {" || lines[len(lines)-1] != "}" {
+			t.Fatalf("Expected a digraph, got:\n%s", b.String())
+		}
+
+		declared := make(map[string]bool)
+		edges := 0
+		for _, line := range lines[1 : len(lines)-1] {
+			if match := nodePattern.FindStringSubmatch(line); match != nil {
+				declared[match[1]] = true
+				continue
+			}
+			match := edgePattern.FindStringSubmatch(line)
+			if match == nil {
+				t.Fatalf("Unexpected DOT statement %q", line)
+			}
+			if !declared[match[1]] || !declared[match[2]] {
+				t.Errorf("Edge %q refers to a node not declared before it", line)
+			}
+			edges++
+		}
+		return len(declared), edges
+	}
+
+	total := countNodes(root)
+	shallow := 1 + len(root.children)
+	for _, child := range root.children {
+		shallow += len(child.children)
+	}
+	t.Logf("Rendering a tree of %d nodes, %d of them down to depth 2", total, shallow)
+
+	if nodes, edges := render(0); nodes != total || edges != total-1 {
+		t.Errorf("Expected %d nodes and %d edges, got %d and %d", total, total-1, nodes, edges)
+	}
+	if nodes, edges := render(2); nodes != shallow || edges != shallow-1 {
+		t.Errorf("Expected %d nodes and %d edges down to depth 2, got %d and %d", shallow, shallow-1, nodes, edges)
+	}
+}
@@ -0,0 +1,94 @@
+package mcts
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sort"
+)
+
+// SequenceResult is a complete sequence found by the search with its fitness
+type SequenceResult struct {
+	Sequence []interface{}
+	Fitness  float64
+}
+
+// RunTopK executes the MCTS algorithm and returns the config.TopK best
+// distinct complete sequences it rolled out, best first
+func RunTopK(
+	initialSequence []interface{},
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) ([]SequenceResult, error) {
+	if config.TopK < 1 {
+		return nil, fmt.Errorf("TopK must be at least 1, got %d", config.TopK)
+	}
+
+	_, result, err := search(context.Background(), initialSequence, nextElements, fitnessFunc, config)
+	if err != nil {
+		return nil, err
+	}
+	return result.TopSequences, nil
+}
+
+// topSequences keeps the best distinct sequences seen so far in a bounded
+// heap with the worst of them on top, so a rollout is compared against a
+// single entry
+type topSequences struct {
+	k        int
+	maximize bool
+	entries  []SequenceResult
+	keys     map[string]bool // Sequences currently kept, by fmt.Sprint
+}
+
+func newTopSequences(k int, config Config) *topSequences {
+	return &topSequences{
+		k:        k,
+		maximize: config.Maximize,
+		keys:     make(map[string]bool),
+	}
+}
+
+func (t *topSequences) Len() int { return len(t.entries) }
+func (t *topSequences) Less(i, j int) bool {
+	return isBetter(t.maximize, t.entries[j].Fitness, t.entries[i].Fitness)
+}
+func (t *topSequences) Swap(i, j int)      { t.entries[i], t.entries[j] = t.entries[j], t.entries[i] }
+func (t *topSequences) Push(x interface{}) { t.entries = append(t.entries, x.(SequenceResult)) }
+func (t *topSequences) Pop() interface{} {
+	last := t.entries[len(t.entries)-1]
+	t.entries = t.entries[:len(t.entries)-1]
+	return last
+}
+
+// add offers a complete sequence, keeping it if it is not kept already and
+// is among the k best
+func (t *topSequences) add(sequence []interface{}, fitness float64) {
+	key := fmt.Sprint(sequence)
+	if t.keys[key] {
+		return
+	}
+	if len(t.entries) == t.k {
+		if !isBetter(t.maximize, fitness, t.entries[0].Fitness) {
+			return
+		}
+		worst := heap.Pop(t).(SequenceResult)
+		delete(t.keys, fmt.Sprint(worst.Sequence))
+	}
+
+	t.keys[key] = true
+	heap.Push(t, SequenceResult{
+		Sequence: append([]interface{}(nil), sequence...),
+		Fitness:  fitness,
+	})
+}
+
+// sorted returns the kept sequences, best first
+func (t *topSequences) sorted() []SequenceResult {
+	results := append([]SequenceResult(nil), t.entries...)
+	sort.SliceStable(results, func(i, j int) bool {
+		return isBetter(t.maximize, results[i].Fitness, results[j].Fitness)
+	})
+	return results
+}
@@ -0,0 +1,43 @@
+package mcts
+
+// CandidateScore breaks down the UCT score of one child considered during
+// a traced selection step
+type CandidateScore struct {
+	Move             interface{}
+	Visits           int
+	AvgFitness       float64 // Value exploited by selection, the mean fitness unless Config.BackupStrategy says otherwise
+	ExplorationBonus float64 // Exploration term of the score, 0 while the child is unvisited or forced by Config.MinVisitsBeforeUCT
+	UCTScore         float64
+}
+
+// SelectionStep records how selection picked a child at one level of a
+// traced iteration
+type SelectionStep struct {
+	Depth      int
+	Sequence   []interface{}
+	Candidates []CandidateScore
+	Chosen     interface{} // nil when no candidate could be chosen
+}
+
+// scoreCandidate breaks down uct, the score of child under
+// explorationConstant. Must be called with child.mu held.
+func scoreCandidate(child *Node, explorationConstant float64, config *Config, uct float64) CandidateScore {
+	score := CandidateScore{
+		Move:     child.sequence[len(child.sequence)-1],
+		Visits:   child.visits,
+		UCTScore: uct,
+	}
+	if child.visits > 0 {
+		score.AvgFitness = exploitation(child, config)
+		_, score.ExplorationBonus = uctTerms(child, explorationConstant, config)
+	}
+	return score
+}
+
+func (step *SelectionStep) log(logger Logger) {
+	logger.Printf("selection depth=%d sequence=%v chosen=%v\n", step.Depth, step.Sequence, step.Chosen)
+	for _, c := range step.Candidates {
+		logger.Printf("  move=%v visits=%d avgFitness=%f explorationBonus=%f uct=%f\n",
+			c.Move, c.Visits, c.AvgFitness, c.ExplorationBonus, c.UCTScore)
+	}
+}
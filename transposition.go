@@ -0,0 +1,52 @@
+package mcts
+
+import "sync"
+
+// usesTranspositions reports whether sequences reaching the same state
+// share a node, keyed by config.HashFunc or, under config.Transpositions,
+// config.StateKey
+func usesTranspositions(config *Config) bool {
+	return config.HashFunc != nil || (config.Transpositions && config.StateKey != nil)
+}
+
+// transpositionKey returns the key of the state sequence leads to,
+// config.HashFunc taking precedence over config.StateKey
+func transpositionKey(sequence []interface{}, config *Config) interface{} {
+	if config.HashFunc != nil {
+		return config.HashFunc(sequence)
+	}
+	return config.StateKey(sequence)
+}
+
+// adoptTransposition looks up a node already reached by a sequence with the
+// same transposition key and length as sequence. If there is one it becomes
+// a child of node. With config.HashFunc its parent pointer is moved to node,
+// so the statistics of the current path are updated when it is
+// backpropagated; with config.StateKey it keeps its first parent, and
+// rollouts through node are backpropagated along the first path only.
+// Returns nil when sequence leads to a new state. Must be called with
+// node.mu held.
+func adoptTransposition(node *Node, sequence []interface{}, key interface{}, transpositions *sync.Map, config *Config) *Node {
+	value, ok := transpositions.Load(key)
+	if !ok {
+		return nil
+	}
+	existing := value.(*Node)
+	if len(existing.sequence) != len(sequence) {
+		return nil // Only merge states at the same depth so the tree stays acyclic
+	}
+
+	for _, child := range node.children {
+		if child == existing {
+			return existing
+		}
+	}
+
+	if config.HashFunc != nil {
+		existing.mu.Lock()
+		existing.parent = node
+		existing.mu.Unlock()
+	}
+	node.children = append(node.children, existing)
+	return existing
+}
@@ -0,0 +1,442 @@
+package mcts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Tree wraps the root of a search tree so it can be kept and resumed
+type Tree struct {
+	Root *Node
+
+	// DecodeMove restores a move saved by MarshalJSON, optional. Without it
+	// moves decode as encoding/json decodes into an interface{}, numbers
+	// becoming float64, so set it whenever nextElements returns other types.
+	DecodeMove func(data json.RawMessage) (interface{}, error)
+}
+
+// treeJSON is the saved form of a Tree
+type treeJSON struct {
+	Sequence []json.RawMessage `json:"sequence"` // Sequence of the root
+	Root     *nodeJSON         `json:"root"`
+}
+
+// nodeJSON is the saved form of a Node, holding the move leading to it
+// instead of its whole sequence. A transposition shared by several parents
+// is saved once with an ID, under the parent its sequence extends, and
+// every other parent holds a child with only Ref set to that ID.
+type nodeJSON struct {
+	Move              json.RawMessage   `json:"move,omitempty"`
+	ID                int               `json:"id,omitempty"`
+	Ref               int               `json:"ref,omitempty"`
+	Visits            int               `json:"visits"`
+	TotalFitness      float64           `json:"total_fitness"`
+	SumSquaredFitness float64           `json:"sum_squared_fitness"`
+	MinFitness        float64           `json:"min_fitness"`
+	MaxFitness        float64           `json:"max_fitness"`
+	LastFitness       float64           `json:"last_fitness"`
+	AMAFVisits        int               `json:"amaf_visits,omitempty"`
+	AMAFFitness       float64           `json:"amaf_fitness,omitempty"`
+	Prior             float64           `json:"prior,omitempty"`
+	Chance            bool              `json:"chance,omitempty"`
+	UnusedMoves       []json.RawMessage `json:"unused_moves,omitempty"`
+	Children          []*nodeJSON       `json:"children,omitempty"`
+}
+
+// MarshalJSON saves the tree with the statistics of every node, so that it
+// can be resumed in another process with RunContinue. Moves are encoded with
+// encoding/json. A node shared by transpositions is saved once, and saving
+// fails if its sequence does not extend that of any of its parents.
+func (tree Tree) MarshalJSON() ([]byte, error) {
+	saved := treeJSON{}
+	if tree.Root != nil {
+		var err error
+		if saved.Sequence, err = marshalMoves(tree.Root.sequence); err != nil {
+			return nil, err
+		}
+		if saved.Root, err = newTreeMarshaler(tree.Root).marshalNode(tree.Root); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(saved)
+}
+
+// UnmarshalJSON restores a tree saved by MarshalJSON, decoding moves with
+// tree.DecodeMove when it is set
+func (tree *Tree) UnmarshalJSON(data []byte) error {
+	var saved treeJSON
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	tree.Root = nil
+	if saved.Root == nil {
+		return nil
+	}
+
+	sequence, err := tree.unmarshalMoves(saved.Sequence)
+	if err != nil {
+		return err
+	}
+	shared := make(map[int]*Node)
+	var refs []treeRef
+	root, err := tree.unmarshalNode(saved.Root, sequence, nil, shared, &refs)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		node, ok := shared[ref.id]
+		if !ok {
+			return fmt.Errorf("reference to unknown node %d", ref.id)
+		}
+		ref.parent.children[ref.index] = node
+	}
+	tree.Root = root
+	return nil
+}
+
+// MarshalTree saves the tree below root like Tree.MarshalJSON, as a
+// checkpoint UnmarshalTree can restore
+func MarshalTree(root *Node) ([]byte, error) {
+	return json.Marshal(Tree{Root: root})
+}
+
+// UnmarshalTree restores a tree saved by MarshalTree or Tree.MarshalJSON,
+// rebuilding the parent of every node, and returns its root for
+// Config.ReuseTree. Moves that are integer numbers decode as int and other
+// moves as encoding/json decodes into an interface{}; unmarshal a Tree with
+// DecodeMove set for other move types.
+func UnmarshalTree(data []byte) (*Node, error) {
+	tree := &Tree{DecodeMove: decodeIntMove}
+	if err := json.Unmarshal(data, tree); err != nil {
+		return nil, err
+	}
+	return tree.Root, nil
+}
+
+// decodeIntMove decodes an integer number as an int, and anything else like
+// encoding/json
+func decodeIntMove(data json.RawMessage) (interface{}, error) {
+	if n, err := strconv.Atoi(string(data)); err == nil {
+		return n, nil
+	}
+	var move interface{}
+	err := json.Unmarshal(data, &move)
+	return move, err
+}
+
+// treeMarshaler saves a tree in which transpositions may share nodes
+type treeMarshaler struct {
+	owners  map[*Node]*Node // Parent each node is saved under, the one its sequence extends
+	parents map[*Node]int   // Number of parents of each node
+	ids     map[*Node]int   // IDs of the shared nodes saved so far
+}
+
+// newTreeMarshaler finds the parents of every node below root
+func newTreeMarshaler(root *Node) *treeMarshaler {
+	m := &treeMarshaler{
+		owners:  make(map[*Node]*Node),
+		parents: make(map[*Node]int),
+		ids:     make(map[*Node]int),
+	}
+	visited := map[*Node]bool{root: true}
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, child := range node.childrenSnapshot() {
+			m.parents[child]++
+			if _, ok := m.owners[child]; !ok && extends(child.sequence, node.sequence) {
+				m.owners[child] = node
+			}
+			if !visited[child] {
+				visited[child] = true
+				stack = append(stack, child)
+			}
+		}
+	}
+	return m
+}
+
+// extends reports whether sequence is parent followed by a single move
+func extends(sequence, parent []interface{}) bool {
+	return len(sequence) == len(parent)+1 && isPrefix(parent, sequence)
+}
+
+func (m *treeMarshaler) marshalNode(node *Node) (*nodeJSON, error) {
+	node.mu.Lock()
+	saved := &nodeJSON{
+		Visits:            node.visits,
+		TotalFitness:      node.totalFitness,
+		SumSquaredFitness: node.sumSquaredFitness,
+		MinFitness:        node.minFitness,
+		MaxFitness:        node.maxFitness,
+		LastFitness:       node.lastFitness,
+		AMAFVisits:        node.amafVisits,
+		AMAFFitness:       node.amafFitness,
+		Prior:             node.prior,
+		Chance:            node.chance,
+	}
+	unusedMoves := append([]interface{}(nil), node.unusedMoves...)
+	children := append([]*Node(nil), node.children...)
+	node.mu.Unlock()
+
+	var err error
+	if node.parent != nil {
+		if saved.Move, err = json.Marshal(node.sequence[len(node.sequence)-1]); err != nil {
+			return nil, err
+		}
+	}
+	if saved.UnusedMoves, err = marshalMoves(unusedMoves); err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		owner, ok := m.owners[child]
+		if !ok {
+			return nil, fmt.Errorf("node %v does not extend the sequence of any of its parents", child.sequence)
+		}
+		if owner != node {
+			saved.Children = append(saved.Children, &nodeJSON{Ref: m.id(child)})
+			continue
+		}
+		savedChild, err := m.marshalNode(child)
+		if err != nil {
+			return nil, err
+		}
+		if m.parents[child] > 1 {
+			savedChild.ID = m.id(child)
+		}
+		saved.Children = append(saved.Children, savedChild)
+	}
+	return saved, nil
+}
+
+// id returns the ID of a shared node, assigning the next one on first use
+func (m *treeMarshaler) id(node *Node) int {
+	if _, ok := m.ids[node]; !ok {
+		m.ids[node] = len(m.ids) + 1
+	}
+	return m.ids[node]
+}
+
+// treeRef is a child of parent saved as a reference to a shared node,
+// resolved once the whole tree is restored
+type treeRef struct {
+	parent *Node
+	index  int
+	id     int
+}
+
+func marshalMoves(moves []interface{}) ([]json.RawMessage, error) {
+	saved := make([]json.RawMessage, len(moves))
+	for i, move := range moves {
+		data, err := json.Marshal(move)
+		if err != nil {
+			return nil, err
+		}
+		saved[i] = data
+	}
+	return saved, nil
+}
+
+func (tree *Tree) unmarshalNode(saved *nodeJSON, sequence []interface{}, parent *Node, shared map[int]*Node, refs *[]treeRef) (*Node, error) {
+	unusedMoves, err := tree.unmarshalMoves(saved.UnusedMoves)
+	if err != nil {
+		return nil, err
+	}
+	node := &Node{
+		sequence:          sequence,
+		parent:            parent,
+		visits:            saved.Visits,
+		totalFitness:      saved.TotalFitness,
+		sumSquaredFitness: saved.SumSquaredFitness,
+		minFitness:        saved.MinFitness,
+		maxFitness:        saved.MaxFitness,
+		lastFitness:       saved.LastFitness,
+		unusedMoves:       unusedMoves,
+		amafVisits:        saved.AMAFVisits,
+		amafFitness:       saved.AMAFFitness,
+		prior:             saved.Prior,
+		chance:            saved.Chance,
+	}
+	if parent != nil {
+		node.depth = parent.depth + 1
+	}
+	if saved.ID != 0 {
+		shared[saved.ID] = node
+	}
+
+	for _, savedChild := range saved.Children {
+		if savedChild.Ref != 0 {
+			*refs = append(*refs, treeRef{parent: node, index: len(node.children), id: savedChild.Ref})
+			node.children = append(node.children, nil)
+			continue
+		}
+		move, err := tree.unmarshalMove(savedChild.Move)
+		if err != nil {
+			return nil, err
+		}
+		childSequence := make([]interface{}, len(sequence)+1)
+		copy(childSequence, sequence)
+		childSequence[len(sequence)] = move
+
+		child, err := tree.unmarshalNode(savedChild, childSequence, node, shared, refs)
+		if err != nil {
+			return nil, err
+		}
+		node.children = append(node.children, child)
+	}
+	return node, nil
+}
+
+func (tree *Tree) unmarshalMoves(saved []json.RawMessage) ([]interface{}, error) {
+	if len(saved) == 0 {
+		return nil, nil
+	}
+	moves := make([]interface{}, len(saved))
+	for i, data := range saved {
+		move, err := tree.unmarshalMove(data)
+		if err != nil {
+			return nil, err
+		}
+		moves[i] = move
+	}
+	return moves, nil
+}
+
+func (tree *Tree) unmarshalMove(data json.RawMessage) (interface{}, error) {
+	if tree.DecodeMove != nil {
+		return tree.DecodeMove(data)
+	}
+	var move interface{}
+	err := json.Unmarshal(data, &move)
+	return move, err
+}
+
+// RunContinue resumes a search on an existing tree, typically the Root of
+// an earlier Result, instead of starting from an empty one
+func RunContinue(
+	ctx context.Context,
+	tree *Tree,
+	nextElements NextElementsFunc,
+	fitnessFunc FitnessFunc,
+	config Config,
+) (*Result, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	_, result, err := searchFrom(ctx, tree.Root, nextElements, fitnessFunc, config)
+	return result, err
+}
+
+// AdvanceRoot returns the child of root reached by chosenMove, detached as
+// the root of its own tree so it can be passed as Config.ReuseTree for the
+// next decision. The siblings of the child are discarded.
+func AdvanceRoot(root *Node, chosenMove interface{}) (*Node, error) {
+	if root == nil {
+		return nil, fmt.Errorf("cannot advance a nil root")
+	}
+
+	root.mu.Lock()
+	defer root.mu.Unlock()
+
+	depth := len(root.sequence)
+	for _, child := range root.children {
+		if !sameMove(child.sequence[depth], chosenMove) {
+			continue
+		}
+		root.children = nil
+		child.mu.Lock()
+		child.parent = nil
+		child.mu.Unlock()
+		return child, nil
+	}
+	return nil, fmt.Errorf("move %v was not expanded at the root", chosenMove)
+}
+
+// ShrinkTree returns a copy of tree holding at most maxNodes nodes, keeping
+// the most visited ones. Moves of dropped children are given back to their
+// parent's unused moves so those branches can be explored again.
+func ShrinkTree(tree *Tree, maxNodes int) *Tree {
+	if tree == nil || tree.Root == nil || maxNodes < 1 {
+		return &Tree{}
+	}
+
+	// Breadth-first order puts parents before children, so a stable sort
+	// by visits keeps every parent ahead of its children on ties
+	var nodes []*Node
+	queued := map[*Node]bool{tree.Root: true}
+	queue := []*Node{tree.Root}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		nodes = append(nodes, node)
+		for _, child := range node.childrenSnapshot() {
+			if !queued[child] { // Shared by transpositions, copied once
+				queued[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	rest := nodes[1:]
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rest[i].Visits() > rest[j].Visits()
+	})
+
+	copies := make(map[*Node]*Node, maxNodes)
+	for _, node := range nodes {
+		if len(copies) >= maxNodes {
+			break
+		}
+		parent, ok := copies[node.parent]
+		if node != tree.Root && !ok {
+			continue // Never keep a node whose parent was dropped
+		}
+
+		node.mu.Lock()
+		clone := &Node{
+			sequence:          node.sequence,
+			parent:            parent,
+			depth:             node.depth,
+			chance:            node.chance,
+			fitness:           node.fitness,
+			fitnessKnown:      node.fitnessKnown,
+			visits:            node.visits,
+			totalFitness:      node.totalFitness,
+			sumSquaredFitness: node.sumSquaredFitness,
+			minFitness:        node.minFitness,
+			maxFitness:        node.maxFitness,
+			lastFitness:       node.lastFitness,
+			unusedMoves:       append([]interface{}(nil), node.unusedMoves...),
+			amafVisits:        node.amafVisits,
+			amafFitness:       node.amafFitness,
+			prior:             node.prior,
+			priorMoves:        node.priorMoves,
+			priors:            node.priors,
+			Metadata:          node.Metadata,
+		}
+		node.mu.Unlock()
+
+		if parent != nil {
+			parent.children = append(parent.children, clone)
+		}
+		copies[node] = clone
+	}
+
+	for original, clone := range copies {
+		for _, child := range original.childrenSnapshot() {
+			childClone, kept := copies[child]
+			switch {
+			case !kept:
+				clone.unusedMoves = append(clone.unusedMoves, child.sequence[len(child.sequence)-1])
+			case childClone.parent != clone:
+				// Also shared with the other parents that were kept
+				clone.children = append(clone.children, childClone)
+			}
+		}
+	}
+
+	return &Tree{Root: copies[tree.Root]}
+}
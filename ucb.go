@@ -0,0 +1,75 @@
+package mcts
+
+import "math"
+
+// Exploration formulas accepted by Config.UCTVariant
+const (
+	// UCTVariantUCB1 is the standard UCB1 bound, C*sqrt(ln(N)/n)
+	UCTVariantUCB1 = "ucb1"
+	// UCTVariantUCB1Tuned scales the UCB1 bound by the empirical variance
+	// of the child's fitness, capped at 1/4, tightening it on children whose
+	// rollouts agree with each other
+	UCTVariantUCB1Tuned = "ucb1-tuned"
+	// UCTVariantPUCT weights exploration by the prior probability of the
+	// move, C*P*sqrt(N)/(1+n), as in AlphaZero
+	UCTVariantPUCT = "puct"
+)
+
+// PriorFunc returns the prior probability of each of moves, the moves
+// available after sequence, in the same order
+type PriorFunc func(sequence []interface{}, moves []interface{}) []float64
+
+// PerMovePrior adapts prior, which scores one move after sequence at a
+// time, to a PriorFunc
+func PerMovePrior(prior func(sequence []interface{}, move interface{}) float64) PriorFunc {
+	return func(sequence []interface{}, moves []interface{}) []float64 {
+		priors := make([]float64, len(moves))
+		for i, move := range moves {
+			priors[i] = prior(sequence, move)
+		}
+		return priors
+	}
+}
+
+// explorationBonus returns the exploration term of node as a child of
+// parent under the formula selected by config.UCTVariant, counting visits
+// as n. Must be called with node.mu held.
+func explorationBonus(node, parent *Node, explorationConstant float64, config *Config, visits int) float64 {
+	n := float64(visits)
+	parentVisits := float64(parent.visits)
+
+	switch config.UCTVariant {
+	case UCTVariantUCB1Tuned:
+		mean := node.totalFitness / float64(node.visits)
+		variance := node.sumSquaredFitness/float64(node.visits) - mean*mean
+		v := math.Max(variance, 0) + math.Sqrt(2*math.Log(parentVisits)/n)
+		return explorationConstant * math.Sqrt(math.Log(parentVisits)/n*math.Min(0.25, v))
+	case UCTVariantPUCT:
+		return explorationConstant * node.prior * math.Sqrt(parentVisits) / (1 + n)
+	default:
+		return explorationConstant * math.Sqrt(math.Log(parentVisits)/n)
+	}
+}
+
+// movePrior returns the prior probability of move among the moves of node,
+// asking config.PriorFunc once per node and falling back to a uniform
+// prior. Must be called with node.mu held.
+func movePrior(node *Node, move interface{}, nextElements NextElementsFunc, config Config) float64 {
+	if node.priorMoves == nil {
+		node.priorMoves = nextElements(node.sequence)
+		if config.PriorFunc != nil {
+			node.priors = config.PriorFunc(node.sequence, node.priorMoves)
+		}
+	}
+
+	for i, candidate := range node.priorMoves {
+		if !sameMove(candidate, move) {
+			continue
+		}
+		if i < len(node.priors) {
+			return node.priors[i]
+		}
+		return 1 / float64(len(node.priorMoves))
+	}
+	return 0
+}
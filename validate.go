@@ -0,0 +1,124 @@
+package mcts
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors wrapped by Config.Validate, so callers can tell them apart with
+// errors.Is. Options that cannot be used together wrap
+// ErrIncompatibleOptions, options set without one they depend on wrap
+// ErrMissingOption, and values out of range or unknown wrap
+// ErrInvalidOption.
+var (
+	ErrNoBudget                   = errors.New("no search budget")
+	ErrInvalidTargetSeqLength     = errors.New("invalid TargetSeqLength")
+	ErrMissingTermination         = errors.New("missing IsSequenceTerminated")
+	ErrInvalidExplorationConstant = errors.New("invalid ExplorationConstant")
+	ErrIncompatibleOptions        = errors.New("incompatible options")
+	ErrMissingOption              = errors.New("missing option")
+	ErrInvalidOption              = errors.New("invalid option")
+)
+
+// Validate reports the first problem with the configuration, or nil when
+// it can be searched with. Every Run variant calls it before searching.
+// An ExplorationConstant of 0 is valid and selects the default of 1.41.
+func (config Config) Validate() error {
+	if config.MaxIterations < 0 || config.MaxDuration < 0 {
+		return fmt.Errorf("%w: MaxIterations and MaxDuration must not be negative, got %d and %v",
+			ErrNoBudget, config.MaxIterations, config.MaxDuration)
+	}
+	if config.MaxIterations == 0 && config.MaxDuration == 0 {
+		return fmt.Errorf("%w: at least one of MaxIterations or MaxDuration must be set", ErrNoBudget)
+	}
+
+	if config.TargetSeqLength < -1 {
+		return fmt.Errorf("%w: must be -1 or a length, got %d", ErrInvalidTargetSeqLength, config.TargetSeqLength)
+	}
+	if config.TargetSeqLength == -1 && config.IsSequenceTerminated == nil {
+		return fmt.Errorf("%w: when TargetSeqLength is -1, IsSequenceTerminated function must be provided", ErrMissingTermination)
+	}
+	if config.MinSeqLength > 0 && config.TargetSeqLength < config.MinSeqLength {
+		return fmt.Errorf("%w: MinSeqLength %d is above TargetSeqLength %d",
+			ErrInvalidTargetSeqLength, config.MinSeqLength, config.TargetSeqLength)
+	}
+
+	if config.BatchFitness != nil && len(config.FitnessComponents) > 0 {
+		return fmt.Errorf("%w: BatchFitness cannot be combined with FitnessComponents", ErrIncompatibleOptions)
+	}
+	if config.BatchFitness != nil && config.IncrementalFitness != nil {
+		return fmt.Errorf("%w: BatchFitness cannot be combined with IncrementalFitness", ErrIncompatibleOptions)
+	}
+	if config.FitnessResultFunc != nil && (config.BatchFitness != nil || config.IncrementalFitness != nil || len(config.FitnessComponents) > 0) {
+		return fmt.Errorf("%w: FitnessResultFunc cannot be combined with BatchFitness, IncrementalFitness or FitnessComponents", ErrIncompatibleOptions)
+	}
+
+	if config.Transpositions && config.StateKey == nil {
+		return fmt.Errorf("%w: Transpositions requires StateKey", ErrMissingOption)
+	}
+
+	if config.IsChanceNode != nil && config.ChanceOutcome == nil {
+		return fmt.Errorf("%w: IsChanceNode requires ChanceOutcome", ErrMissingOption)
+	}
+
+	if config.PruneThreshold < 0 {
+		return fmt.Errorf("%w: PruneThreshold must not be negative, got %f", ErrInvalidOption, config.PruneThreshold)
+	}
+
+	if config.MaxDepth < 0 {
+		return fmt.Errorf("%w: MaxDepth must not be negative, got %d", ErrInvalidOption, config.MaxDepth)
+	}
+
+	if config.ExplorationConstant < 0 {
+		return fmt.Errorf("%w: must not be negative, got %f", ErrInvalidExplorationConstant, config.ExplorationConstant)
+	}
+
+	switch config.UCTVariant {
+	case "", UCTVariantUCB1, UCTVariantUCB1Tuned, UCTVariantPUCT:
+	default:
+		return fmt.Errorf("%w: unknown UCTVariant %q", ErrInvalidOption, config.UCTVariant)
+	}
+
+	if config.VirtualLoss < 0 {
+		return fmt.Errorf("%w: VirtualLoss must not be negative, got %f", ErrInvalidOption, config.VirtualLoss)
+	}
+
+	if config.ExplorationDecay < 0 || config.ExplorationDecay > 1 {
+		return fmt.Errorf("%w: ExplorationDecay must be between 0 and 1, got %f", ErrInvalidOption, config.ExplorationDecay)
+	}
+
+	if config.DiscountFactor < 0 || config.DiscountFactor > 1 {
+		return fmt.Errorf("%w: DiscountFactor must be between 0 and 1, got %f", ErrInvalidOption, config.DiscountFactor)
+	}
+
+	switch config.FinalSelectionCriteria {
+	case "", FinalSelectionBestFitness, FinalSelectionMostVisits, FinalSelectionMixed:
+	default:
+		return fmt.Errorf("%w: unknown FinalSelectionCriteria %q", ErrInvalidOption, config.FinalSelectionCriteria)
+	}
+
+	if config.Temperature < 0 {
+		return fmt.Errorf("%w: Temperature must not be negative, got %f", ErrInvalidOption, config.Temperature)
+	}
+
+	switch config.BackupStrategy {
+	case "", BackupMean, BackupMax, BackupMin, BackupLast:
+	default:
+		return fmt.Errorf("%w: unknown BackupStrategy %q", ErrInvalidOption, config.BackupStrategy)
+	}
+
+	if len(config.FitnessComponents) > 0 && len(config.FitnessWeights) != len(config.FitnessComponents) {
+		return fmt.Errorf("%w: FitnessWeights must have one weight per FitnessComponents entry, got %d for %d", ErrInvalidOption,
+			len(config.FitnessWeights), len(config.FitnessComponents))
+	}
+
+	if config.RootParallel && config.Parallelism > 1 && !config.InteractiveMode {
+		if config.ReuseTree != nil {
+			return fmt.Errorf("%w: RootParallel cannot continue a ReuseTree", ErrIncompatibleOptions)
+		}
+		if config.MinSeqLength > 0 {
+			return fmt.Errorf("%w: MinSeqLength cannot be combined with RootParallel", ErrIncompatibleOptions)
+		}
+	}
+	return nil
+}